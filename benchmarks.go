@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fritchie/fio_benchmark_exporter/shellwords"
+)
+
+// benchmarkSpec configures a benchmark the exporter runs on its own
+// schedule, the results are exported with Name as the benchmark label
+type benchmarkSpec struct {
+	Name                    string `yaml:"name"`
+	Benchmark               string `yaml:"benchmark"`
+	BenchmarkRuntime        string `yaml:"benchmarkRuntime"`
+	CronSchedule            string `yaml:"cronSchedule"`
+	CustomBenchmarkFioFlags string `yaml:"customBenchmarkFioFlags"`
+	Directory               string `yaml:"directory"`
+	FileSize                string `yaml:"fileSize"`
+	FileSizeMin             string `yaml:"fileSizeMin"`
+	FileSizeMax             string `yaml:"fileSizeMax"`
+	JobFile                 string `yaml:"jobFile"`
+	// Targets are directories or block devices a predefined benchmark runs
+	// against in turn, Directory if empty
+	Targets []string `yaml:"targets"`
+	// flagTargets is set if Directory and Targets are taken from the flags,
+	// discovered mounts replace them
+	flagTargets bool
+}
+
+// presets holds the fio flags of the predefined benchmarks
+var presets = map[string]string{
+	"iops":       "--name=iops --numjobs=4 --ioengine=libaio --direct=1 --bs=4k --iodepth=128 --readwrite=randrw",
+	"latency":    "--name=latency --numjobs=1 --ioengine=libaio --direct=1 --bs=4k --iodepth=1 --readwrite=randrw",
+	"throughput": "--name=throughput --numjobs=4 --ioengine=libaio --direct=1 --bs=128k --iodepth=64 --readwrite=rw",
+}
+
+// fioOptions holds the fio flags shared by all benchmarks
+type fioOptions struct {
+	// outputFlags select the fio output format and the percentiles it reports
+	outputFlags []string
+	// groupReporting is set unless perJob is set
+	groupReporting bool
+	// statusInterval is the fio --status-interval, empty without statusUpdates
+	statusInterval string
+}
+
+// flags returns the output and reporting flags every fio command uses
+func (opts fioOptions) flags() []string {
+	flags := append([]string(nil), opts.outputFlags...)
+	if opts.groupReporting {
+		flags = append(flags, "--group_reporting")
+	}
+	return flags
+}
+
+// benchmarkSpecFlag collects the specs of a repeated -benchmarkSpec flag
+type benchmarkSpecFlag []string
+
+func (f *benchmarkSpecFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *benchmarkSpecFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// parseBenchmarkSpec parses a spec of semicolon separated key=value pairs,
+// keys are named after the flags they override and missing keys are taken
+// from defaults
+func parseBenchmarkSpec(s string, defaults benchmarkSpec) (benchmarkSpec, error) {
+	spec := defaults
+	spec.Name = ""
+	for _, pair := range strings.Split(s, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return spec, fmt.Errorf("invalid benchmarkSpec %q: %q is not key=value", s, pair)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "name":
+			spec.Name = value
+		case "benchmark":
+			spec.Benchmark = value
+		case "benchmarkRuntime":
+			spec.BenchmarkRuntime = value
+		case "cronSchedule":
+			spec.CronSchedule = value
+		case "customBenchmarkFioFlags":
+			spec.CustomBenchmarkFioFlags = value
+		case "directory":
+			spec.Directory = value
+			spec.Targets = nil
+			spec.flagTargets = false
+		case "fileSize":
+			spec.FileSize = value
+		case "fileSizeMin":
+			spec.FileSizeMin = value
+		case "fileSizeMax":
+			spec.FileSizeMax = value
+		case "jobFile":
+			spec.JobFile = value
+		case "targets":
+			spec.Targets = splitList(value)
+			spec.flagTargets = false
+		default:
+			return spec, fmt.Errorf("invalid benchmarkSpec %q: unknown key %q", s, key)
+		}
+	}
+	if spec.Name == "" {
+		spec.Name = spec.defaultName()
+	}
+	return spec, nil
+}
+
+// splitList splits a comma separated list, empty items are dropped
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// defaultName names a spec after its benchmark, or after its job file as
+// the job sections are exported under their own names
+func (spec *benchmarkSpec) defaultName() string {
+	if spec.JobFile != "" {
+		return filepath.Base(spec.JobFile)
+	}
+	return spec.Benchmark
+}
+
+// validate checks the spec for settings the exporter cannot run with
+func (spec *benchmarkSpec) validate() error {
+	var errs []error
+	if spec.Name == "" {
+		errs = append(errs, errors.New("benchmark without a name"))
+	}
+	errs = append(errs, spec.validateSchedule()...)
+
+	if spec.JobFile != "" {
+		// job files replace the predefined and custom benchmarks
+		if spec.CustomBenchmarkFioFlags != "" {
+			errs = append(errs, fmt.Errorf("%s: jobFile and customBenchmarkFioFlags cannot be used at the same time", spec.Name))
+		}
+		if len(spec.Targets) > 0 {
+			errs = append(errs, fmt.Errorf("%s: targets are only used by predefined benchmarks", spec.Name))
+		}
+		return errors.Join(errs...)
+	}
+	if _, ok := presets[spec.Benchmark]; !ok && spec.Benchmark != "custom" {
+		errs = append(errs, fmt.Errorf("%s: invalid benchmark %q, must be iops, latency, throughput or custom", spec.Name, spec.Benchmark))
+	}
+	if spec.Benchmark != "custom" {
+		return errors.Join(errs...)
+	}
+	if len(spec.Targets) > 0 {
+		errs = append(errs, fmt.Errorf("%s: targets are only used by predefined benchmarks", spec.Name))
+	}
+
+	// make sure custom fio flags supplied for custom benchmark
+	if spec.CustomBenchmarkFioFlags == "" {
+		errs = append(errs, fmt.Errorf("%s: customBenchmarkFioFlags must be used when benchmark is custom", spec.Name))
+	}
+	args, err := shellwords.Split(spec.CustomBenchmarkFioFlags)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("%s: invalid customBenchmarkFioFlags: %w", spec.Name, err))
+	}
+
+	// the output format is chosen with the outputFormat flag
+	// custom benchmarks cannot use the --output-format or --output flags
+	for _, f := range args {
+		if strings.HasPrefix(f, "--output") {
+			errs = append(errs, fmt.Errorf("%s: customBenchmarkFioFlags cannot contain the flag --output-format or --output", spec.Name))
+			break
+		}
+	}
+
+	// make sure custom benchmark does not include any percentile related flags
+	if strings.Contains(spec.CustomBenchmarkFioFlags, "percentile") {
+		errs = append(errs, fmt.Errorf("%s: customBenchmarkFioFlags cannot contain any percentile related flags", spec.Name))
+	}
+	return errors.Join(errs...)
+}
+
+// commands returns the fio commands of the spec, a job file spec has a
+// command for every job section
+func (spec *benchmarkSpec) commands(opts fioOptions) ([]benchmarkCommand, error) {
+	args := []string{"fio"}
+	if spec.JobFile != "" {
+		fioFlags := opts.flags()
+		if opts.statusInterval != "" {
+			fioFlags = append(fioFlags, "--status-interval="+opts.statusInterval)
+		}
+		commands, err := jobFileCommands(spec.JobFile, fioFlags)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid jobFile: %w", spec.Name, err)
+		}
+		return commands, nil
+	}
+
+	if spec.Benchmark == "custom" {
+		custom, err := shellwords.Split(spec.CustomBenchmarkFioFlags)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid customBenchmarkFioFlags: %w", spec.Name, err)
+		}
+		args = append(args, opts.flags()...)
+		args = append(args, custom...)
+		return []benchmarkCommand{newCommand(spec.Name, "", args)}, nil
+	}
+
+	fileSize, err := parseAutoFileSize(spec.FileSize, spec.FileSizeMin, spec.FileSizeMax)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec.Name, err)
+	}
+	args = append(args, strings.Fields(presets[spec.Benchmark])...)
+	if opts.statusInterval != "" {
+		args = append(args, "--status-interval="+opts.statusInterval)
+	}
+	// every target is benchmarked in turn
+	var commands []benchmarkCommand
+	for _, target := range spec.targets() {
+		targetArgs := append([]string(nil), args...)
+		// a block device is benchmarked directly, a directory holds the data
+		// files
+		if isBlockDevice(target) {
+			targetArgs = append(targetArgs, "--filename="+target)
+		} else {
+			targetArgs = append(targetArgs, "--directory="+target)
+		}
+		targetArgs = append(targetArgs,
+			"--size="+spec.FileSize,
+			"--runtime="+spec.BenchmarkRuntime,
+			"--time_based",
+		)
+		targetArgs = append(targetArgs, opts.flags()...)
+		bc := newCommand(spec.Name, target, targetArgs)
+		bc.fileSize = fileSize
+		commands = append(commands, bc)
+	}
+	return commands, nil
+}
+
+// newCommand returns the benchmarkCommand running fio with args
+func newCommand(benchmark, target string, args []string) benchmarkCommand {
+	return benchmarkCommand{
+		benchmark: benchmark,
+		target:    target,
+		args:      args,
+		runtime:   fioArgsRuntime(args),
+		files:     fioArgsFiles(args),
+		jobs:      parseFioJobs(args),
+	}
+}
+
+// targets returns the directories and block devices the spec runs
+// against, the directory unless targets are set
+func (spec *benchmarkSpec) targets() []string {
+	if len(spec.Targets) > 0 {
+		return spec.Targets
+	}
+	return []string{spec.Directory}
+}
+
+// isBlockDevice reports whether path is a block device
+func isBlockDevice(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeDevice != 0 && info.Mode()&os.ModeCharDevice == 0
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testDefaults = benchmarkSpec{
+	Name:             "latency",
+	Benchmark:        "latency",
+	BenchmarkRuntime: "60",
+	CronSchedule:     "0 */6 * * *",
+	Directory:        "/tmp",
+	FileSize:         "1G",
+}
+
+func TestParseBenchmarkSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		want benchmarkSpec
+	}{
+		{
+			"benchmark=throughput",
+			benchmarkSpec{Name: "throughput", Benchmark: "throughput", BenchmarkRuntime: "60", CronSchedule: "0 */6 * * *", Directory: "/tmp", FileSize: "1G"},
+		},
+		{
+			"name=nightly; benchmark=throughput; cronSchedule=0 2 * * *; benchmarkRuntime=600; fileSize=10G; directory=/data",
+			benchmarkSpec{Name: "nightly", Benchmark: "throughput", BenchmarkRuntime: "600", CronSchedule: "0 2 * * *", Directory: "/data", FileSize: "10G"},
+		},
+		{
+			"name=hourly;cronSchedule=0 * * * *;",
+			benchmarkSpec{Name: "hourly", Benchmark: "latency", BenchmarkRuntime: "60", CronSchedule: "0 * * * *", Directory: "/tmp", FileSize: "1G"},
+		},
+		{
+			"name=rw;benchmark=custom;customBenchmarkFioFlags=--name=rw --readwrite=rw --bs=64k",
+			benchmarkSpec{Name: "rw", Benchmark: "custom", BenchmarkRuntime: "60", CronSchedule: "0 */6 * * *", CustomBenchmarkFioFlags: "--name=rw --readwrite=rw --bs=64k", Directory: "/tmp", FileSize: "1G"},
+		},
+		{
+			"targets=/, /data ,/mnt/pvc",
+			benchmarkSpec{Name: "latency", Benchmark: "latency", BenchmarkRuntime: "60", CronSchedule: "0 */6 * * *", Directory: "/tmp", FileSize: "1G", Targets: []string{"/", "/data", "/mnt/pvc"}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseBenchmarkSpec(tt.spec, testDefaults)
+		if err != nil {
+			t.Errorf("%q: %s", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"benchmark", "size=1G", "name=a;name"} {
+		if _, err := parseBenchmarkSpec(spec, testDefaults); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestBenchmarkSpecValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*benchmarkSpec)
+		ok   bool
+	}{
+		{"defaults", func(s *benchmarkSpec) {}, true},
+		{"unknown benchmark", func(s *benchmarkSpec) { s.Benchmark = "random" }, false},
+		{"custom without flags", func(s *benchmarkSpec) { s.Benchmark = "custom" }, false},
+		{"custom", func(s *benchmarkSpec) { s.Benchmark, s.CustomBenchmarkFioFlags = "custom", "--name=a --bs=4k" }, true},
+		{"custom output", func(s *benchmarkSpec) { s.Benchmark, s.CustomBenchmarkFioFlags = "custom", "--name=a --output=/tmp/a" }, false},
+		{"custom percentiles", func(s *benchmarkSpec) { s.Benchmark, s.CustomBenchmarkFioFlags = "custom", "--percentile_list=50" }, false},
+		{"job file with flags", func(s *benchmarkSpec) { s.JobFile, s.CustomBenchmarkFioFlags = "jobs.fio", "--name=a" }, false},
+		{"no name", func(s *benchmarkSpec) { s.Name = "" }, false},
+		{"cron", func(s *benchmarkSpec) { s.CronSchedule = "0 */6 * *" }, false},
+		{"cron descriptor", func(s *benchmarkSpec) { s.CronSchedule = "@hourly" }, true},
+		{"runtime", func(s *benchmarkSpec) { s.BenchmarkRuntime = "10m" }, true},
+		{"invalid runtime", func(s *benchmarkSpec) { s.BenchmarkRuntime = "1.5h" }, false},
+		{"size", func(s *benchmarkSpec) { s.FileSize = "512MiB" }, true},
+		{"size percent", func(s *benchmarkSpec) { s.FileSize = "10%" }, true},
+		{"invalid size", func(s *benchmarkSpec) { s.FileSize = "1 GB" }, false},
+		{"size free", func(s *benchmarkSpec) { s.FileSize = "free:10%" }, true},
+		{"size ram", func(s *benchmarkSpec) { s.FileSize, s.FileSizeMin, s.FileSizeMax = "ram:2x", "1G", "100G" }, true},
+		{"invalid size ram", func(s *benchmarkSpec) { s.FileSize = "ram:two" }, false},
+		{"invalid size max", func(s *benchmarkSpec) { s.FileSize, s.FileSizeMax = "free:10%", "100 G" }, false},
+		{"relative directory", func(s *benchmarkSpec) { s.Directory = "tmp" }, false},
+		{"targets", func(s *benchmarkSpec) { s.Targets = []string{"/", "/data"} }, true},
+		{"relative target", func(s *benchmarkSpec) { s.Targets = []string{"/", "data"} }, false},
+		{"duplicate target", func(s *benchmarkSpec) { s.Targets = []string{"/data", "/data"} }, false},
+		{"custom targets", func(s *benchmarkSpec) {
+			s.Benchmark, s.CustomBenchmarkFioFlags, s.Targets = "custom", "--name=a", []string{"/"}
+		}, false},
+	}
+	for _, tt := range tests {
+		spec := testDefaults
+		tt.edit(&spec)
+		if err := spec.validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: got %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestBenchmarkSpecCommands(t *testing.T) {
+	opts := fioOptions{outputFlags: []string{"--output-format=json", "--lat_percentiles=1", "--clat_percentiles=1"}, groupReporting: true}
+	tests := []struct {
+		name string
+		spec benchmarkSpec
+		opts fioOptions
+		want string
+	}{
+		{
+			"preset",
+			benchmarkSpec{Name: "hourly", Benchmark: "latency", BenchmarkRuntime: "60", Directory: "/tmp", FileSize: "1G"},
+			opts,
+			"fio " + presets["latency"] + " --directory=/tmp --size=1G --runtime=60 --time_based --output-format=json --lat_percentiles=1 --clat_percentiles=1 --group_reporting",
+		},
+		{
+			"preset with status updates",
+			benchmarkSpec{Name: "hourly", Benchmark: "latency", BenchmarkRuntime: "60", Directory: "/mnt/my disk", FileSize: "1G"},
+			fioOptions{outputFlags: []string{"--output-format=terse", "--terse-version=5", "--lat_percentiles=1", "--clat_percentiles=0"}, statusInterval: "30"},
+			"fio " + presets["latency"] + " --status-interval=30 '--directory=/mnt/my disk' --size=1G --runtime=60 --time_based --output-format=terse --terse-version=5 --lat_percentiles=1 --clat_percentiles=0",
+		},
+		{
+			"custom",
+			benchmarkSpec{Name: "rw", Benchmark: "custom", CustomBenchmarkFioFlags: "--name=rw  --readwrite=rw"},
+			opts,
+			"fio --output-format=json --lat_percentiles=1 --clat_percentiles=1 --group_reporting --name=rw --readwrite=rw",
+		},
+	}
+	for _, tt := range tests {
+		got, err := tt.spec.commands(tt.opts)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if len(got) != 1 || got[0].benchmark != tt.spec.Name || got[0].String() != tt.want {
+			t.Errorf("%s: got %v, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBenchmarkSpecCommandsQuoting(t *testing.T) {
+	spec := benchmarkSpec{
+		Name:                    "custom",
+		Benchmark:               "custom",
+		CustomBenchmarkFioFlags: `--name=custom --filename="/mnt/my disk/f" --description='nightly run'`,
+	}
+	if err := spec.validate(); err == nil {
+		t.Error("validate: expected error for empty cronSchedule")
+	}
+	got, err := spec.commands(fioOptions{outputFlags: []string{"--output-format=json", "--lat_percentiles=1", "--clat_percentiles=1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"fio", "--output-format=json", "--lat_percentiles=1", "--clat_percentiles=1",
+		"--name=custom", "--filename=/mnt/my disk/f", "--description=nightly run"}
+	if !reflect.DeepEqual(got[0].args, want) {
+		t.Errorf("got %q, want %q", got[0].args, want)
+	}
+
+	spec.CustomBenchmarkFioFlags = `--name=custom --description="nightly run`
+	if _, err := spec.commands(fioOptions{}); err == nil {
+		t.Error("unterminated quote: expected error")
+	}
+}
+
+func TestBenchmarkSpecCommandsTargets(t *testing.T) {
+	spec := testDefaults
+	spec.Targets = []string{"/", "/mnt/pvc"}
+	commands, err := spec.commands(fioOptions{outputFlags: []string{"--output-format=json"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 2 {
+		t.Fatalf("got %d commands, want 2", len(commands))
+	}
+	for i, target := range spec.Targets {
+		bc := commands[i]
+		if bc.benchmark != "latency" || bc.target != target || !strings.Contains(bc.String(), " --directory="+target+" ") {
+			t.Errorf("%s: got %s %s: %s", target, bc.benchmark, bc.target, bc)
+		}
+	}
+}
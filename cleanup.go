@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// removeDataFiles removes the files matching the glob patterns of a fio
+// command and returns the bytes freed. Only regular files are removed.
+func removeDataFiles(patterns []string) (int64, error) {
+	var freed int64
+	var errs []error
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, file := range files {
+			info, err := os.Lstat(file)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			if err := os.Remove(file); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			freed += info.Size()
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return freed, fmt.Errorf("removing fio data files: %w", err)
+	}
+	return freed, nil
+}
+
+// removeFiles removes the data files of a fio command and counts the bytes
+// freed
+func removeFiles(bc benchmarkCommand) {
+	freed, err := removeDataFiles(bc.files)
+	if err != nil {
+		log.Printf("Benchmark %s: %s\n", bc.benchmark, err)
+	}
+	if freed > 0 {
+		log.Printf("Removed %d bytes of fio data files of benchmark %s\n", freed, bc.benchmark)
+	}
+	fioDataFilesRemoved.WithLabelValues(bc.series().runValues()...).Add(float64(freed))
+}
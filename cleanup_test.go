@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRemoveFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"latency.0.0":   "0123456789",
+		"latency.1.0":   "01234",
+		"latency.notes": "not a data file",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// only regular files are removed
+	if err := os.Symlink(filepath.Join(dir, "latency.notes"), filepath.Join(dir, "latency.2.0")); err != nil {
+		t.Fatal(err)
+	}
+
+	bc := benchmarkCommand{benchmark: "cleanup", files: []string{filepath.Join(dir, "latency.[0-9]*.[0-9]*")}}
+	removeFiles(bc)
+	if v := testutil.ToFloat64(fioDataFilesRemoved.WithLabelValues(series{benchmark: "cleanup"}.runValues()...)); v != 15 {
+		t.Errorf("got %v bytes removed, want 15", v)
+	}
+	for _, name := range []string{"latency.0.0", "latency.1.0"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s not removed: %v", name, err)
+		}
+	}
+	for _, name := range []string{"latency.notes", "latency.2.0"} {
+		if _, err := os.Lstat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s removed: %v", name, err)
+		}
+	}
+}
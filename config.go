@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// config holds the exporter settings, flags provide the defaults and the
+// config file, YAML or JSON, overrides them
+type config struct {
+	OutputFormat         string        `yaml:"outputFormat"`
+	PerJob               bool          `yaml:"perJob"`
+	NativeHistograms     bool          `yaml:"nativeHistograms"`
+	StatusUpdates        bool          `yaml:"statusUpdates"`
+	StatusUpdateInterval string        `yaml:"statusUpdateInterval"`
+	RunOnce              bool          `yaml:"runOnce"`
+	RunOnceWait          time.Duration `yaml:"runOnceWait"`
+	SkipInitialBenchmark bool          `yaml:"skipInitialBenchmark"`
+	// RunTimeout limits the duration of a fio run, 0 allows the runtime of
+	// the benchmark plus RunTimeoutGrace
+	RunTimeout      time.Duration `yaml:"runTimeout"`
+	RunTimeoutGrace time.Duration `yaml:"runTimeoutGrace"`
+	// FreeSpaceMargin is the space left free by the data files of a run,
+	// a fio size or a percentage of the filesystem size
+	FreeSpaceMargin string `yaml:"freeSpaceMargin"`
+	// AllowTmpfs allows benchmark directories on tmpfs
+	AllowTmpfs bool `yaml:"allowTmpfs"`
+	// AllowRawDevices allows block devices as targets, fio writes to them
+	// and destroys their data
+	AllowRawDevices bool `yaml:"allowRawDevices"`
+	// KeepDataFiles keeps the files fio lays out for the next run instead
+	// of removing them after every run and on startup
+	KeepDataFiles bool `yaml:"keepDataFiles"`
+	// ShutdownTimeout limits the time to stop fio, remove its data files
+	// and close the HTTP server on SIGTERM or SIGINT
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	// RetryAttempts is the number of retries of a failed benchmark before
+	// waiting for its next scheduled run
+	RetryAttempts int `yaml:"retryAttempts"`
+	// RetryBackoff is the wait before the first retry, it doubles with
+	// every retry
+	RetryBackoff time.Duration `yaml:"retryBackoff"`
+	// Labels are added to every exported metric
+	Labels     map[string]string `yaml:"labels"`
+	HTTP       httpConfig        `yaml:"http"`
+	Discovery  discoveryConfig   `yaml:"discovery"`
+	Benchmarks []benchmarkSpec   `yaml:"benchmarks"`
+}
+
+// httpConfig holds the settings of the metrics endpoint
+type httpConfig struct {
+	ListenAddress string `yaml:"listenAddress"`
+	MetricsPath   string `yaml:"metricsPath"`
+}
+
+// metricLabels are the labels used by exported metrics, constant labels
+// cannot reuse them
+var metricLabels = []string{"benchmark", "job", "jobname", "depth", "unit", "le", "disk", "direction", "reason", "directory", "target", "mountpoint", "fstype", "device", "model", "serial", "rotational", "scheduler", "logical_block_size", "nr_requests"}
+
+var (
+	// fio sizes are a number of bytes with an optional unit, or a
+	// percentage of the device or file size
+	fioSizePattern = regexp.MustCompile(`(?i)^([0-9]+(\.[0-9]+)?([kmgtp](i?b)?)?|[0-9]+(\.[0-9]+)?%)$`)
+	// fio durations are an integer with an optional unit, seconds if none
+	fioDurationPattern = regexp.MustCompile(`(?i)^([0-9]+)(us|usec|ms|msec|s|sec|m|min|h|hour|d|day)?$`)
+	// fioBytesPattern matches the absolute fio sizes of fioSizePattern
+	fioBytesPattern  = regexp.MustCompile(`(?i)^([0-9]+(\.[0-9]+)?)(([kmgtp])((i)b|b)?)?$`)
+	labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// fioDurationUnits maps the units of fio times to durations
+var fioDurationUnits = map[string]time.Duration{
+	"":     time.Second,
+	"us":   time.Microsecond,
+	"usec": time.Microsecond,
+	"ms":   time.Millisecond,
+	"msec": time.Millisecond,
+	"s":    time.Second,
+	"sec":  time.Second,
+	"m":    time.Minute,
+	"min":  time.Minute,
+	"h":    time.Hour,
+	"hour": time.Hour,
+	"d":    24 * time.Hour,
+	"day":  24 * time.Hour,
+}
+
+// parseFioDuration parses a fio time like the value of --runtime
+func parseFioDuration(s string) (time.Duration, error) {
+	m := fioDurationPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid fio time %q", s)
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid fio time %q: %w", s, err)
+	}
+	return time.Duration(n) * fioDurationUnits[strings.ToLower(m[2])], nil
+}
+
+// errRelativeSize is returned for a fio size that is a percentage
+var errRelativeSize = errors.New("size is a percentage")
+
+// parseFioSize parses an absolute fio size like the value of --size. Like
+// fio with its default kb_base=1024, k and kb are 1024 bytes while kib is
+// 1000 bytes.
+func parseFioSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "%") && fioSizePattern.MatchString(s) {
+		return 0, errRelativeSize
+	}
+	m := fioBytesPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid fio size %q", s)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid fio size %q: %w", s, err)
+	}
+	if m[4] != "" {
+		base := 1024.0
+		if m[6] != "" {
+			base = 1000
+		}
+		n *= math.Pow(base, float64(strings.Index("kmgtp", strings.ToLower(m[4]))+1))
+	}
+	return int64(n), nil
+}
+
+// loadConfig reads the config file at path over c, benchmarks in the file
+// replace the benchmarks of c and take unset settings from defaults
+func loadConfig(path string, c *config, defaults benchmarkSpec) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	benchmarks := c.Benchmarks
+	c.Benchmarks = nil
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(c.Benchmarks) == 0 {
+		c.Benchmarks = benchmarks
+		return nil
+	}
+	for i := range c.Benchmarks {
+		c.Benchmarks[i].setDefaults(defaults)
+		// relative job files are found next to the config file
+		if jf := c.Benchmarks[i].JobFile; jf != "" && !filepath.IsAbs(jf) {
+			c.Benchmarks[i].JobFile = filepath.Join(filepath.Dir(path), jf)
+		}
+	}
+	return nil
+}
+
+// fioOptions returns the fio flags shared by all benchmarks
+func (c *config) fioOptions() fioOptions {
+	var opts fioOptions
+	switch c.OutputFormat {
+	case "terse":
+		// terse output holds a single set of percentiles, the total latency
+		opts.outputFlags = []string{"--output-format=terse", "--terse-version=5",
+			"--lat_percentiles=1", "--clat_percentiles=0"}
+	default:
+		opts.outputFlags = []string{"--output-format=" + c.OutputFormat,
+			"--lat_percentiles=1", "--clat_percentiles=1"}
+	}
+	// every job is reported separately unless perJob is set
+	opts.groupReporting = !c.PerJob
+	if c.StatusUpdates {
+		opts.statusInterval = c.StatusUpdateInterval
+	}
+	return opts
+}
+
+// commands returns the fio commands of every benchmark, benchmarks are
+// exported by name so names must be unique
+func (c *config) commands() ([][]benchmarkCommand, error) {
+	return c.buildCommands(nil)
+}
+
+// buildCommands returns the fio commands of every benchmark. The commands
+// of the specs in invalid, which failed validation, are not built so their
+// errors are not reported again, only their names are checked.
+func (c *config) buildCommands(invalid map[int]bool) ([][]benchmarkCommand, error) {
+	opts := c.fioOptions()
+	benchmarks := make([][]benchmarkCommand, len(c.Benchmarks))
+	seen := make(map[string]bool)
+	var errs []error
+	for i := range c.Benchmarks {
+		spec := &c.Benchmarks[i]
+		if invalid[i] {
+			if seen[spec.Name] {
+				errs = append(errs, fmt.Errorf("benchmark name %s is used more than once", spec.Name))
+			}
+			seen[spec.Name] = true
+			continue
+		}
+		commands, err := c.specCommands(spec, opts)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// benchmarks are queued by name, job file specs need a unique name
+		// besides the names of their sections
+		if spec.JobFile != "" {
+			if seen[spec.Name] {
+				errs = append(errs, fmt.Errorf("benchmark name %s is used more than once", spec.Name))
+			}
+			seen[spec.Name] = true
+		}
+		for j, bc := range commands {
+			// the commands of the targets of a spec share its name
+			if j > 0 && bc.benchmark == commands[j-1].benchmark {
+				continue
+			}
+			if seen[bc.benchmark] {
+				errs = append(errs, fmt.Errorf("benchmark name %s is used more than once", bc.benchmark))
+			}
+			seen[bc.benchmark] = true
+		}
+		benchmarks[i] = commands
+	}
+	return benchmarks, errors.Join(errs...)
+}
+
+// discovers reports whether the spec runs against discovered mounts,
+// predefined benchmarks taking their targets from the flags do
+func (c *config) discovers(spec *benchmarkSpec) bool {
+	return c.Discovery.enabled() && spec.flagTargets && spec.JobFile == "" && spec.Benchmark != "custom"
+}
+
+// specCommands returns the fio commands of the spec, against the mounts
+// discovered now if the spec uses discovery
+func (c *config) specCommands(spec *benchmarkSpec, opts fioOptions) ([]benchmarkCommand, error) {
+	if !c.discovers(spec) {
+		return spec.commands(opts)
+	}
+	mounts, err := c.Discovery.discover()
+	if err != nil {
+		return nil, fmt.Errorf("%s: discovering mounts: %w", spec.Name, err)
+	}
+	if len(mounts) == 0 {
+		log.Printf("No mounts discovered for benchmark %s\n", spec.Name)
+		return nil, nil
+	}
+	discovered := *spec
+	discovered.Targets = nil
+	for _, m := range mounts {
+		discovered.Targets = append(discovered.Targets, m.dir())
+	}
+	commands, err := discovered.commands(opts)
+	if err != nil {
+		return nil, err
+	}
+	// there is a command for every target
+	for i := range commands {
+		commands[i].mount = mounts[i]
+		commands[i].discovered = true
+	}
+	return commands, nil
+}
+
+// rediscover returns the commands of the benchmark name against the
+// mounts discovered now, ok is false if the benchmark does not use
+// discovery or discovery failed
+func (c *config) rediscover(name string) (commands []benchmarkCommand, ok bool) {
+	for i := range c.Benchmarks {
+		spec := &c.Benchmarks[i]
+		if spec.Name != name || !c.discovers(spec) {
+			continue
+		}
+		commands, err := c.specCommands(spec, c.fioOptions())
+		if err != nil {
+			log.Printf("%s, running against the mounts discovered before\n", err)
+			return nil, false
+		}
+		return commands, true
+	}
+	return nil, false
+}
+
+// validate checks the config and reports every problem found
+func (c *config) validate() error {
+	var errs []error
+	switch c.OutputFormat {
+	case "terse", "json", "json+":
+	default:
+		errs = append(errs, fmt.Errorf("invalid outputFormat %q, must be terse, json or json+", c.OutputFormat))
+	}
+
+	// terse status updates print one line per job without a marker for the
+	// start of an update, so lines cannot be matched to jobs
+	if c.PerJob && c.StatusUpdates && c.OutputFormat == "terse" {
+		errs = append(errs, errors.New("perJob and statusUpdates require outputFormat json or json+"))
+	}
+	if _, err := parseFioDuration(c.StatusUpdateInterval); c.StatusUpdates && err != nil {
+		errs = append(errs, fmt.Errorf("invalid statusUpdateInterval %q, must be a fio time like 30 or 30s", c.StatusUpdateInterval))
+	}
+	if c.RunOnce && c.SkipInitialBenchmark {
+		errs = append(errs, errors.New("runOnce and skipInitialBenchmark cannot be used at the same time"))
+	}
+
+	if c.RunTimeout < 0 || c.RunTimeoutGrace < 0 {
+		errs = append(errs, fmt.Errorf("invalid runTimeout %s or runTimeoutGrace %s, must not be negative", c.RunTimeout, c.RunTimeoutGrace))
+	}
+	if !fioSizePattern.MatchString(c.FreeSpaceMargin) {
+		errs = append(errs, fmt.Errorf("invalid freeSpaceMargin %q, must be a fio size like 10G or a percentage like 5%%", c.FreeSpaceMargin))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("invalid shutdownTimeout %s, must be positive", c.ShutdownTimeout))
+	}
+	if c.RetryAttempts < 0 {
+		errs = append(errs, fmt.Errorf("invalid retryAttempts %d, must not be negative", c.RetryAttempts))
+	}
+	if c.RetryAttempts > 0 && c.RetryBackoff <= 0 {
+		errs = append(errs, fmt.Errorf("invalid retryBackoff %s, must be positive", c.RetryBackoff))
+	}
+
+	for name := range c.Labels {
+		if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			errs = append(errs, fmt.Errorf("invalid label name %q", name))
+		}
+		for _, l := range metricLabels {
+			if name == l {
+				errs = append(errs, fmt.Errorf("label %s is used by the exporter", name))
+			}
+		}
+	}
+
+	errs = append(errs, c.Discovery.validate()...)
+
+	if _, _, err := net.SplitHostPort(c.HTTP.ListenAddress); err != nil {
+		errs = append(errs, fmt.Errorf("invalid http listenAddress %q: %w", c.HTTP.ListenAddress, err))
+	}
+	switch {
+	case !strings.HasPrefix(c.HTTP.MetricsPath, "/"), c.HTTP.MetricsPath == "/runs", c.HTTP.MetricsPath == "/-/reload":
+		errs = append(errs, fmt.Errorf("invalid http metricsPath %q", c.HTTP.MetricsPath))
+	}
+
+	if len(c.Benchmarks) == 0 {
+		errs = append(errs, errors.New("no benchmarks configured"))
+	}
+	invalid := make(map[int]bool)
+	for i := range c.Benchmarks {
+		spec := &c.Benchmarks[i]
+		if err := spec.validate(); err != nil {
+			errs = append(errs, err)
+			invalid[i] = true
+		}
+		if spec.JobFile != "" || spec.Benchmark == "custom" || c.AllowRawDevices || c.discovers(spec) {
+			continue
+		}
+		for _, target := range spec.targets() {
+			if isBlockDevice(target) {
+				errs = append(errs, fmt.Errorf("%s: target %s is a block device, fio overwrites its data, set allowRawDevices to use it", spec.Name, target))
+			}
+		}
+	}
+	// building the commands finds duplicate names and unreadable job files
+	if _, err := c.buildCommands(invalid); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// runTimeout returns the time a fio command may run before it is killed,
+// 0 if there is no limit
+func (c *config) runTimeout(bc benchmarkCommand) time.Duration {
+	if c.RunTimeout > 0 {
+		return c.RunTimeout
+	}
+	if bc.runtime > 0 {
+		return bc.runtime + c.RunTimeoutGrace
+	}
+	return 0
+}
+
+// restartChanges returns the settings that differ between c and n and
+// only take effect after a restart
+func (c *config) restartChanges(n *config) []string {
+	var changes []string
+	if c.HTTP != n.HTTP {
+		changes = append(changes, "http")
+	}
+	if !reflect.DeepEqual(c.Labels, n.Labels) {
+		changes = append(changes, "labels")
+	}
+	if c.NativeHistograms != n.NativeHistograms {
+		changes = append(changes, "nativeHistograms")
+	}
+	if c.RunOnce != n.RunOnce || c.RunOnceWait != n.RunOnceWait {
+		changes = append(changes, "runOnce")
+	}
+	return changes
+}
+
+// setDefaults fills the unset settings of the spec from defaults
+func (spec *benchmarkSpec) setDefaults(defaults benchmarkSpec) {
+	if spec.Benchmark == "" && spec.JobFile == "" {
+		spec.Benchmark = defaults.Benchmark
+	}
+	if spec.Name == "" {
+		spec.Name = spec.defaultName()
+	}
+	if spec.BenchmarkRuntime == "" {
+		spec.BenchmarkRuntime = defaults.BenchmarkRuntime
+	}
+	if spec.CronSchedule == "" {
+		spec.CronSchedule = defaults.CronSchedule
+	}
+	// a directory set for the spec replaces the default targets
+	if len(spec.Targets) == 0 && spec.Directory == "" {
+		spec.Targets = defaults.Targets
+		spec.flagTargets = defaults.flagTargets
+	}
+	if spec.Directory == "" {
+		spec.Directory = defaults.Directory
+	}
+	if spec.FileSize == "" {
+		spec.FileSize = defaults.FileSize
+	}
+	if spec.FileSizeMin == "" {
+		spec.FileSizeMin = defaults.FileSizeMin
+	}
+	if spec.FileSizeMax == "" {
+		spec.FileSizeMax = defaults.FileSizeMax
+	}
+}
+
+// validateSchedule checks the fio size and duration strings and the cron
+// schedule of the spec
+func (spec *benchmarkSpec) validateSchedule() []error {
+	var errs []error
+	if _, err := cron.ParseStandard(spec.CronSchedule); err != nil {
+		errs = append(errs, fmt.Errorf("%s: invalid cronSchedule %q: %w", spec.Name, spec.CronSchedule, err))
+	}
+	// the remaining settings are only used by predefined benchmarks
+	if spec.JobFile != "" || spec.Benchmark == "custom" {
+		return errs
+	}
+	if _, err := parseFioDuration(spec.BenchmarkRuntime); err != nil {
+		errs = append(errs, fmt.Errorf("%s: invalid benchmarkRuntime %q, must be a fio time like 60 or 10m", spec.Name, spec.BenchmarkRuntime))
+	}
+	if auto, err := parseAutoFileSize(spec.FileSize, spec.FileSizeMin, spec.FileSizeMax); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", spec.Name, err))
+	} else if auto == nil && !fioSizePattern.MatchString(spec.FileSize) {
+		errs = append(errs, fmt.Errorf("%s: invalid fileSize %q, must be a fio size like 1G or 512MiB, free:<percent>%% or ram:<multiple>x", spec.Name, spec.FileSize))
+	}
+	seen := make(map[string]bool)
+	for _, target := range spec.targets() {
+		if !filepath.IsAbs(target) {
+			errs = append(errs, fmt.Errorf("%s: directory or target %q must be an absolute path", spec.Name, target))
+		}
+		if seen[target] {
+			errs = append(errs, fmt.Errorf("%s: target %s is used more than once", spec.Name, target))
+		}
+		seen[target] = true
+	}
+	return errs
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConfig returns the config built from the default flags
+func testConfig() config {
+	return config{
+		OutputFormat:         "terse",
+		StatusUpdateInterval: "30",
+		RunOnceWait:          time.Hour,
+		RunTimeoutGrace:      10 * time.Minute,
+		ShutdownTimeout:      25 * time.Second,
+		FreeSpaceMargin:      "5%",
+		HTTP:                 httpConfig{ListenAddress: ":9996", MetricsPath: "/metrics"},
+		Benchmarks:           []benchmarkSpec{testDefaults},
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg := testConfig()
+	if err := loadConfig(filepath.Join("testdata", "config.yaml"), &cfg, testDefaults); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate: %s", err)
+	}
+	if cfg.OutputFormat != "json" || !cfg.StatusUpdates || cfg.StatusUpdateInterval != "30s" {
+		t.Errorf("got outputFormat %s, statusUpdates %v, statusUpdateInterval %s", cfg.OutputFormat, cfg.StatusUpdates, cfg.StatusUpdateInterval)
+	}
+	if want := map[string]string{"cluster": "prod-eu", "storageclass": "ssd"}; !reflect.DeepEqual(cfg.Labels, want) {
+		t.Errorf("got labels %v, want %v", cfg.Labels, want)
+	}
+	if cfg.HTTP.ListenAddress != "127.0.0.1:9996" {
+		t.Errorf("got listenAddress %s", cfg.HTTP.ListenAddress)
+	}
+	want := []benchmarkSpec{
+		{Name: "hourly-latency", Benchmark: "latency", BenchmarkRuntime: "60", CronSchedule: "0 * * * *", Directory: "/tmp", FileSize: "1G"},
+		{Name: "nightly-throughput", Benchmark: "throughput", BenchmarkRuntime: "10m", CronSchedule: "0 2 * * *", Directory: "/data", FileSize: "10G"},
+		{Name: "seq.fio", BenchmarkRuntime: "60", CronSchedule: "@daily", Directory: "/tmp", FileSize: "1G", JobFile: filepath.Join("testdata", "jobs", "seq.fio")},
+	}
+	if !reflect.DeepEqual(cfg.Benchmarks, want) {
+		t.Errorf("got benchmarks\n%+v\nwant\n%+v", cfg.Benchmarks, want)
+	}
+
+	benchmarks, err := cfg.commands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(benchmarks) != 3 || benchmarks[2][0].benchmark != "seqread-1m" {
+		t.Errorf("got commands %v", benchmarks)
+	}
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	cfg := testConfig()
+	if err := loadConfig(filepath.Join("testdata", "config.json"), &cfg, testDefaults); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate: %s", err)
+	}
+	if cfg.OutputFormat != "json+" || cfg.RunOnceWait != 30*time.Minute {
+		t.Errorf("got outputFormat %s, runOnceWait %s", cfg.OutputFormat, cfg.RunOnceWait)
+	}
+	// settings missing from the file keep their flag values
+	if cfg.HTTP.ListenAddress != ":9996" || cfg.Benchmarks[0].CronSchedule != "0 */6 * * *" {
+		t.Errorf("got listenAddress %s, cronSchedule %s", cfg.HTTP.ListenAddress, cfg.Benchmarks[0].CronSchedule)
+	}
+}
+
+func TestConfigValidateReportsAllErrors(t *testing.T) {
+	cfg := testConfig()
+	if err := loadConfig(filepath.Join("testdata", "invalid.yaml"), &cfg, testDefaults); err != nil {
+		t.Fatal(err)
+	}
+	err := cfg.validate()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{
+		`invalid outputFormat "csv"`,
+		"label benchmark is used by the exporter",
+		`invalid http listenAddress "9996"`,
+		`a: invalid cronSchedule "0 * * *"`,
+		`a: invalid fileSize "1 GB"`,
+		`a: invalid benchmarkRuntime "1.5h"`,
+		"benchmark name a is used more than once",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing error %q in:\n%s", want, err)
+		}
+	}
+}
+
+func TestLoadConfigUnknownField(t *testing.T) {
+	cfg := testConfig()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("benchmarks:\n  - name: a\n    runtime: 60\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(path, &cfg, testDefaults); err == nil {
+		t.Error("expected error for unknown field runtime")
+	}
+}
+
+func TestParseFioDuration(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+	}{
+		{"60", time.Minute},
+		{"30s", 30 * time.Second},
+		{"10m", 10 * time.Minute},
+		{"500msec", 500 * time.Millisecond},
+		{"2H", 2 * time.Hour},
+		{"1d", 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		got, err := parseFioDuration(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %s, %v, want %s", tt.s, got, err, tt.want)
+		}
+	}
+	for _, s := range []string{"", "1.5h", "10 m", "-1"} {
+		if _, err := parseFioDuration(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	cfg := testConfig()
+	timed := benchmarkCommand{benchmark: "timed", runtime: time.Minute}
+	untimed := benchmarkCommand{benchmark: "untimed"}
+	if got := cfg.runTimeout(timed); got != 11*time.Minute {
+		t.Errorf("runtime plus grace: got %s, want 11m", got)
+	}
+	if got := cfg.runTimeout(untimed); got != 0 {
+		t.Errorf("without runtime: got %s, want no timeout", got)
+	}
+	cfg.RunTimeout = 5 * time.Minute
+	if got := cfg.runTimeout(untimed); got != 5*time.Minute {
+		t.Errorf("runTimeout: got %s, want 5m", got)
+	}
+	cfg.RunTimeout = -time.Minute
+	if err := cfg.validate(); err == nil {
+		t.Error("negative runTimeout: expected error")
+	}
+}
+
+func TestFioOptionsPercentiles(t *testing.T) {
+	for format, want := range map[string]string{
+		"terse": "--output-format=terse --terse-version=5 --lat_percentiles=1 --clat_percentiles=0 --group_reporting",
+		"json":  "--output-format=json --lat_percentiles=1 --clat_percentiles=1 --group_reporting",
+		"json+": "--output-format=json+ --lat_percentiles=1 --clat_percentiles=1 --group_reporting",
+	} {
+		cfg := testConfig()
+		cfg.OutputFormat = format
+		if got := strings.Join(cfg.fioOptions().flags(), " "); got != want {
+			t.Errorf("%s: got %s, want %s", format, got, want)
+		}
+	}
+}
+
+func TestParseFioSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+	}{
+		{"4096", 4096},
+		{"4k", 4096},
+		{"1G", 1 << 30},
+		{"1gb", 1 << 30},
+		{"1GiB", 1000 * 1000 * 1000},
+		{"1.5M", 3 << 19},
+	}
+	for _, tt := range tests {
+		got, err := parseFioSize(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %d, %v, want %d", tt.s, got, err, tt.want)
+		}
+	}
+	if _, err := parseFioSize("10%"); !errors.Is(err, errRelativeSize) {
+		t.Errorf("10%%: got %v, want errRelativeSize", err)
+	}
+	for _, s := range []string{"", "1 GB", "1Gi", "G"} {
+		if _, err := parseFioSize(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestValidateRawDevices(t *testing.T) {
+	const device = "/dev/loop0"
+	if !isBlockDevice(device) {
+		t.Skipf("%s is not a block device", device)
+	}
+	cfg := testConfig()
+	cfg.Benchmarks[0].Targets = []string{"/tmp", device}
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "allowRawDevices") {
+		t.Errorf("block device target: got %v", err)
+	}
+	cfg.AllowRawDevices = true
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	benchmarks, err := cfg.commands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bc := benchmarks[0][1]; bc.target != device || !strings.Contains(bc.String(), " --filename="+device+" ") || len(bc.files) != 0 {
+		t.Errorf("got %s, files %q", bc, bc.files)
+	}
+}
+
+func TestConfigValidateReportsErrorsOnce(t *testing.T) {
+	for _, mod := range []func(*benchmarkSpec){
+		func(s *benchmarkSpec) { s.Benchmark, s.CustomBenchmarkFioFlags = "custom", `--name="unterminated` },
+		func(s *benchmarkSpec) { s.FileSize = "free:200%" },
+	} {
+		cfg := testConfig()
+		mod(&cfg.Benchmarks[0])
+		err := cfg.validate()
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		lines := strings.Split(err.Error(), "\n")
+		seen := make(map[string]bool)
+		for _, line := range lines {
+			if seen[line] {
+				t.Errorf("error %q reported twice", line)
+			}
+			seen[line] = true
+		}
+	}
+}
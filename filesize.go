@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// meminfoPath is read for the RAM of the system
+var meminfoPath = "/proc/meminfo"
+
+// autoFileSize is a fileSize resolved before every run, the data files of
+// all jobs of a benchmark take a percentage of the free space of the
+// benchmark directory or a multiple of the RAM of the system
+type autoFileSize struct {
+	// ram is set for a multiple of the RAM, unset for a share of the free
+	// space
+	ram bool
+	// factor is the multiple of the RAM or the share of the free space
+	factor float64
+	// min and max clamp the size of the data file of every job, 0 if unset
+	min, max int64
+}
+
+// parseAutoFileSize parses a fileSize of the form free:<percent>% or
+// ram:<multiple>x, it returns nil for other sizes. min and max are fio
+// sizes, empty if unset.
+func parseAutoFileSize(s, min, max string) (*autoFileSize, error) {
+	var a autoFileSize
+	switch {
+	case strings.HasPrefix(s, "free:"):
+		percent, ok := strings.CutSuffix(strings.TrimPrefix(s, "free:"), "%")
+		f, err := strconv.ParseFloat(percent, 64)
+		if !ok || err != nil || f <= 0 || f > 100 {
+			return nil, fmt.Errorf("invalid fileSize %q, free space must be a percentage like free:10%%", s)
+		}
+		a.factor = f / 100
+	case strings.HasPrefix(s, "ram:"):
+		multiple, ok := strings.CutSuffix(strings.TrimPrefix(s, "ram:"), "x")
+		f, err := strconv.ParseFloat(multiple, 64)
+		if !ok || err != nil || f <= 0 {
+			return nil, fmt.Errorf("invalid fileSize %q, RAM must be a multiple like ram:2x", s)
+		}
+		a.ram, a.factor = true, f
+	default:
+		return nil, nil
+	}
+
+	var err error
+	if min != "" {
+		if a.min, err = parseFioSize(min); err != nil {
+			return nil, fmt.Errorf("invalid fileSizeMin: %w", err)
+		}
+	}
+	if max != "" {
+		if a.max, err = parseFioSize(max); err != nil {
+			return nil, fmt.Errorf("invalid fileSizeMax: %w", err)
+		}
+	}
+	if a.max > 0 && a.min > a.max {
+		return nil, fmt.Errorf("fileSizeMin %s is larger than fileSizeMax %s", min, max)
+	}
+	return &a, nil
+}
+
+// bytes returns the size of the data file of each of numjobs jobs. free is
+// the free space of the benchmark directory including data files kept from
+// an earlier run.
+func (a *autoFileSize) bytes(free int64, numjobs int) (int64, error) {
+	total := float64(free)
+	if a.ram {
+		ram, err := memTotal()
+		if err != nil {
+			return 0, err
+		}
+		total = float64(ram)
+	}
+	// sizes are rounded down to MiB so they suit every block size
+	size := int64(total*a.factor/float64(numjobs)) &^ (1<<20 - 1)
+	if a.min > 0 && size < a.min {
+		size = a.min
+	}
+	if a.max > 0 && size > a.max {
+		size = a.max
+	}
+	if size <= 0 {
+		return 0, errors.New("fileSize resolves to 0 bytes")
+	}
+	return size, nil
+}
+
+// memTotal returns the RAM of the system in bytes
+func memTotal() (int64, error) {
+	f, err := os.Open(meminfoPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// MemTotal:       16318480 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "MemTotal:" && fields[2] == "kB" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("%s: %w", meminfoPath, err)
+			}
+			return kb * 1024, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no MemTotal in %s", meminfoPath)
+}
+
+// resolveFileSize returns bc with its auto fileSize resolved to bytes and
+// exports the size of the data file of every job
+func (bc benchmarkCommand) resolveFileSize() (benchmarkCommand, error) {
+	if bc.fileSize != nil {
+		j := bc.jobs[0]
+		dir, _, ok := j.dataSpace()
+		if !ok && !bc.fileSize.ram {
+			return bc, fmt.Errorf("a free: fileSize needs a directory, %s is a block device", bc.target)
+		}
+		// only a free: fileSize depends on the free space, a device has none
+		var free int64
+		if ok {
+			var st syscall.Statfs_t
+			if err := syscall.Statfs(dir, &st); err != nil {
+				return bc, fmt.Errorf("statfs %s: %w", dir, err)
+			}
+			free = int64(st.Bavail)*int64(st.Bsize) + existingBytes(bc.files)
+		}
+		size, err := bc.fileSize.bytes(free, j.numjobs)
+		if err != nil {
+			return bc, err
+		}
+		value := strconv.FormatInt(size, 10)
+		args := append([]string(nil), bc.args...)
+		for i, arg := range args {
+			if strings.HasPrefix(arg, "--size=") {
+				args[i] = "--size=" + value
+			}
+		}
+		jobs := append([]fioJob(nil), bc.jobs...)
+		for i := range jobs {
+			jobs[i].size = value
+		}
+		bc.args, bc.jobs = args, jobs
+	}
+	if len(bc.jobs) > 0 {
+		if size, err := parseFioSize(bc.jobs[0].size); err == nil {
+			fioBenchmarkFileSize.WithLabelValues(bc.series().runValues()...).Set(float64(size))
+		}
+	}
+	return bc, nil
+}
+
+// existingBytes returns the size of the regular files matching the glob
+// patterns of data files
+func existingBytes(patterns []string) int64 {
+	var n int64
+	for _, pattern := range patterns {
+		files, _ := filepath.Glob(pattern)
+		for _, file := range files {
+			if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+				n += info.Size()
+			}
+		}
+	}
+	return n
+}
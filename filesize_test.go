@@ -0,0 +1,126 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseAutoFileSize(t *testing.T) {
+	tests := []struct {
+		size, min, max string
+		want           *autoFileSize
+	}{
+		{"1G", "", "", nil},
+		{"10%", "", "", nil},
+		{"free:10%", "", "", &autoFileSize{factor: 0.1}},
+		{"ram:2x", "1G", "100G", &autoFileSize{ram: true, factor: 2, min: 1 << 30, max: 100 << 30}},
+	}
+	for _, tt := range tests {
+		got, err := parseAutoFileSize(tt.size, tt.min, tt.max)
+		if err != nil {
+			t.Errorf("%q: %s", tt.size, err)
+			continue
+		}
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.size, got, tt.want)
+		}
+	}
+
+	for _, s := range [][3]string{{"free:0%"}, {"free:150%"}, {"free:10"}, {"ram:0x"}, {"ram:2"}, {"ram:2x", "10G", "1G"}, {"ram:2x", "1 G"}} {
+		if _, err := parseAutoFileSize(s[0], s[1], s[2]); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestAutoFileSizeBytes(t *testing.T) {
+	defer func(path string) { meminfoPath = path }(meminfoPath)
+	meminfoPath = filepath.Join("testdata", "meminfo")
+
+	tests := []struct {
+		size, min, max string
+		free           int64
+		numjobs        int
+		want           int64
+	}{
+		// 10% of 40GiB split over 4 jobs
+		{"free:10%", "", "", 40 << 30, 4, 1 << 30},
+		// rounded down to MiB
+		{"free:50%", "", "", 3<<20 + 12345, 1, 1 << 20},
+		{"free:10%", "2G", "", 10 << 30, 1, 2 << 30},
+		{"free:50%", "", "1G", 10 << 30, 1, 1 << 30},
+		// 2 x 8GiB of RAM
+		{"ram:2x", "", "", 0, 1, 16 << 30},
+		{"ram:0.5x", "", "", 0, 4, 1 << 30},
+	}
+	for _, tt := range tests {
+		a, err := parseAutoFileSize(tt.size, tt.min, tt.max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := a.bytes(tt.free, tt.numjobs)
+		if err != nil || got != tt.want {
+			t.Errorf("%s of %d over %d jobs: got %d, %v, want %d", tt.size, tt.free, tt.numjobs, got, err, tt.want)
+		}
+	}
+
+	a, _ := parseAutoFileSize("free:1%", "", "")
+	if _, err := a.bytes(1<<20, 1); err == nil {
+		t.Error("size below 1MiB: expected error")
+	}
+}
+
+func TestResolveFileSize(t *testing.T) {
+	defer func(path string) { meminfoPath = path }(meminfoPath)
+	meminfoPath = filepath.Join("testdata", "meminfo")
+
+	spec := testDefaults
+	spec.Name, spec.Benchmark, spec.FileSize, spec.Directory = "autosize", "iops", "ram:1x", t.TempDir()
+	commands, err := spec.commands(fioOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := commands[0].resolveFileSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 8GiB of RAM split over the 4 jobs of the iops benchmark
+	if !strings.Contains(bc.String(), " --size=2147483648 ") || bc.jobs[0].size != "2147483648" {
+		t.Errorf("got %s", bc)
+	}
+	if strings.Contains(commands[0].String(), "--size=2147483648") {
+		t.Error("resolving changed the command")
+	}
+	if v := testutil.ToFloat64(fioBenchmarkFileSize.WithLabelValues(bc.series().runValues()...)); v != 2<<30 {
+		t.Errorf("got file size %v, want %d", v, 2<<30)
+	}
+}
+
+func TestResolveFileSizeDevice(t *testing.T) {
+	defer func(path string) { meminfoPath = path }(meminfoPath)
+	meminfoPath = filepath.Join("testdata", "meminfo")
+
+	const device = "/dev/loop0"
+	if !isBlockDevice(device) {
+		t.Skipf("%s is not a block device", device)
+	}
+	args := []string{"fio", "--name=latency", "--filename=" + device, "--size=ram:1x"}
+	bc := newCommand("autosize-device", device, args)
+	bc.fileSize = &autoFileSize{ram: true, factor: 1}
+	bc, err := bc.resolveFileSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bc.jobs[0].size != "8589934592" {
+		t.Errorf("got size %s, want 8589934592", bc.jobs[0].size)
+	}
+
+	bc = newCommand("autosize-device", device, args)
+	bc.fileSize = &autoFileSize{factor: 0.1}
+	if _, err := bc.resolveFileSize(); err == nil {
+		t.Error("free: fileSize on a device: expected error")
+	}
+}
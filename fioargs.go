@@ -0,0 +1,134 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fioArg is a fio option given as --name=value or as --name value
+type fioArg struct {
+	name, value string
+}
+
+// parseFioArgs returns the options of fio arguments, the value of an option
+// without = is the next argument as fio takes required values from there
+func parseFioArgs(args []string) []fioArg {
+	var opts []fioArg
+	for i, arg := range args {
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok && i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+			value = args[i+1]
+		}
+		opts = append(opts, fioArg{strings.TrimPrefix(name, "--"), value})
+	}
+	return opts
+}
+
+// fioArgsRuntime returns the runtime plus the ramp_time set by fio
+// arguments, 0 without a runtime
+func fioArgsRuntime(args []string) time.Duration {
+	var runtime, ramp time.Duration
+	for _, opt := range parseFioArgs(args) {
+		d, err := parseFioDuration(opt.value)
+		if err != nil {
+			continue
+		}
+		switch opt.name {
+		case "runtime":
+			runtime = d
+		case "ramp_time":
+			ramp = d
+		}
+	}
+	if runtime == 0 {
+		return 0
+	}
+	return runtime + ramp
+}
+
+// fioJob holds the options of a fio job that decide where its data files
+// are and how large they are
+type fioJob struct {
+	name      string
+	directory string
+	filename  string
+	// size is the fio size of every clone of the job
+	size    string
+	numjobs int
+}
+
+// parseFioJobs returns the jobs fio arguments define. Every --name starts a
+// job, options before the first job apply to all jobs.
+func parseFioJobs(args []string) []fioJob {
+	global := fioJob{numjobs: 1}
+	var jobs []fioJob
+	cur := &global
+	for _, opt := range parseFioArgs(args) {
+		switch opt.name {
+		case "name":
+			jobs = append(jobs, global)
+			cur = &jobs[len(jobs)-1]
+			cur.name = opt.value
+		case "directory":
+			cur.directory = opt.value
+		case "filename":
+			cur.filename = opt.value
+		case "size":
+			cur.size = opt.value
+		case "numjobs":
+			if n, err := strconv.Atoi(opt.value); err == nil && n > 0 {
+				cur.numjobs = n
+			}
+		}
+	}
+	return jobs
+}
+
+// files returns glob patterns of the data files of the job, fio names the
+// files of a job <name>.<job>.<file> in its directory unless the job sets a
+// filename
+func (j fioJob) files() []string {
+	if j.filename == "" {
+		if j.name == "" {
+			return nil
+		}
+		return []string{filepath.Join(j.directory, j.name+".[0-9]*.[0-9]*")}
+	}
+	// fio separates multiple files with colons
+	var files []string
+	for _, f := range strings.Split(j.filename, ":") {
+		if f == "" {
+			continue
+		}
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(j.directory, f)
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+// fioArgsFiles returns glob patterns of the data files fio lays out for the
+// jobs fio arguments define. Files given with filename may hold data fio
+// only reads, e.g. with --readonly, and are not data files.
+func fioArgsFiles(args []string) []string {
+	var patterns []string
+	seen := make(map[string]bool)
+	for _, j := range parseFioJobs(args) {
+		if j.filename != "" {
+			continue
+		}
+		for _, p := range j.files() {
+			if !seen[p] {
+				seen[p] = true
+				patterns = append(patterns, p)
+			}
+		}
+	}
+	return patterns
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFioArgsRuntime(t *testing.T) {
+	tests := []struct {
+		args string
+		want time.Duration
+	}{
+		{"--name=a --bs=4k", 0},
+		{"--name=a --runtime=90 --time_based", 90 * time.Second},
+		{"--name=a --runtime 5m --ramp_time=30s", 5*time.Minute + 30*time.Second},
+		{"--name=a --ramp_time=30s", 0},
+		{"--name=a --runtime=1.5h", 0},
+	}
+	for _, tt := range tests {
+		if got := fioArgsRuntime(strings.Fields(tt.args)); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestFioArgsFiles(t *testing.T) {
+	tests := []struct {
+		args string
+		want []string
+	}{
+		{"fio " + presets["iops"] + " --directory=/data --size=1G", []string{"/data/iops.[0-9]*.[0-9]*"}},
+		{"fio --directory=/data --name=a --name=b --directory=/mnt", []string{"/data/a.[0-9]*.[0-9]*", "/mnt/b.[0-9]*.[0-9]*"}},
+		// files given with filename are not data files
+		{"fio --name=a --filename=/dev/nvme0n1", nil},
+		{"fio --directory /data --name a --filename=f1:f2 --name=b", []string{"/data/b.[0-9]*.[0-9]*"}},
+		{"fio --bs=4k", nil},
+	}
+	for _, tt := range tests {
+		if got := fioArgsFiles(strings.Fields(tt.args)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
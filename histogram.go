@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/fritchie/fio_benchmark_exporter/terseparser"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	// latencyBuckets are the classic buckets of the latency histograms (seconds)
+	latencyBuckets = prometheus.ExponentialBuckets(0.000001, 2, 25)
+	// nativeHistograms adds native (sparse) buckets to the latency histograms
+	nativeHistograms = false
+)
+
+// nativeHistogramSchema gives a bucket growth factor of 2^(2^-3) ~ 1.09
+const nativeHistogramSchema = 3
+
+// latencyHistogram exports the fio json+ latency bins of the last run of
+// each benchmark or job as a Prometheus histogram. fio already counts the
+// IOs per bin so the histogram is built from the bins at scrape time
+// instead of observing every IO.
+type latencyHistogram struct {
+	desc *prometheus.Desc
+
+	mu   sync.Mutex
+	runs map[series]latencyRun
+}
+
+type latencyRun struct {
+	start time.Time
+	bins  []terseparser.Bin
+}
+
+func newLatencyHistogram(name, help string) *latencyHistogram {
+	return &latencyHistogram{
+		desc: prometheus.NewDesc(name, help, labels, nil),
+		runs: make(map[series]latencyRun),
+	}
+}
+
+// Set replaces the bins of a series, fio bins are cumulative for the whole
+// run so every status update replaces the previous one
+func (h *latencyHistogram) Set(s series, start time.Time, bins []terseparser.Bin) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.runs[s] = latencyRun{start: start, bins: bins}
+}
+
+func (h *latencyHistogram) Describe(ch chan<- *prometheus.Desc) {
+	ch <- h.desc
+}
+
+func (h *latencyHistogram) Collect(ch chan<- prometheus.Metric) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s, run := range h.runs {
+		m, err := h.metric(s, run)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(h.desc, err)
+			continue
+		}
+		ch <- m
+	}
+}
+
+func (h *latencyHistogram) metric(s series, run latencyRun) (prometheus.Metric, error) {
+	var count uint64
+	var sum float64
+	buckets := make(map[float64]uint64, len(latencyBuckets))
+	for _, b := range run.bins {
+		v := b.Value / 1e6
+		count += b.Count
+		sum += v * float64(b.Count)
+		for _, upper := range latencyBuckets {
+			if v <= upper {
+				buckets[upper] += b.Count
+			}
+		}
+	}
+	if !nativeHistograms {
+		return prometheus.NewConstHistogram(h.desc, count, sum, buckets, s.values()...)
+	}
+
+	positive := make(map[int]int64)
+	var zero uint64
+	scale := math.Exp2(nativeHistogramSchema)
+	for _, b := range run.bins {
+		v := b.Value / 1e6
+		if v <= prometheus.DefNativeHistogramZeroThreshold {
+			zero += b.Count
+			continue
+		}
+		// bucket i holds values in (2^((i-1)/scale), 2^(i/scale)]
+		positive[int(math.Ceil(math.Log2(v)*scale))] += int64(b.Count)
+	}
+	m, err := prometheus.NewConstNativeHistogram(h.desc, count, sum, positive, nil, zero,
+		nativeHistogramSchema, prometheus.DefNativeHistogramZeroThreshold, run.start, s.values()...)
+	if err != nil {
+		return nil, err
+	}
+	return &classicBuckets{Metric: m, buckets: buckets}, nil
+}
+
+// classicBuckets adds classic buckets to a native histogram so scrapers
+// without native histogram support still get a usable histogram
+type classicBuckets struct {
+	prometheus.Metric
+	buckets map[float64]uint64
+}
+
+func (c *classicBuckets) Write(m *dto.Metric) error {
+	if err := c.Metric.Write(m); err != nil {
+		return err
+	}
+	for _, upper := range latencyBuckets {
+		upper, count := upper, c.buckets[upper]
+		m.Histogram.Bucket = append(m.Histogram.Bucket, &dto.Bucket{
+			UpperBound:      &upper,
+			CumulativeCount: &count,
+		})
+	}
+	return nil
+}
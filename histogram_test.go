@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fritchie/fio_benchmark_exporter/terseparser"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var testBins = []terseparser.Bin{
+	{Value: 1.5, Count: 10},
+	{Value: 3, Count: 5},
+	{Value: 1000, Count: 1},
+}
+
+func TestLatencyHistogramClassic(t *testing.T) {
+	saved := latencyBuckets
+	defer func() { latencyBuckets = saved }()
+	latencyBuckets = []float64{0.000002, 0.000004, 0.001}
+
+	h := newLatencyHistogram("test_latency_seconds", "Test latency")
+	h.Set(series{benchmark: "latency"}, time.Now(), testBins)
+
+	want := `
+# HELP test_latency_seconds Test latency
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{benchmark="latency",device="",fstype="",job="",jobname="",mountpoint="",target="",le="2e-06"} 10
+test_latency_seconds_bucket{benchmark="latency",device="",fstype="",job="",jobname="",mountpoint="",target="",le="4e-06"} 15
+test_latency_seconds_bucket{benchmark="latency",device="",fstype="",job="",jobname="",mountpoint="",target="",le="0.001"} 16
+test_latency_seconds_bucket{benchmark="latency",device="",fstype="",job="",jobname="",mountpoint="",target="",le="+Inf"} 16
+test_latency_seconds_sum{benchmark="latency",device="",fstype="",job="",jobname="",mountpoint="",target=""} 0.00103
+test_latency_seconds_count{benchmark="latency",device="",fstype="",job="",jobname="",mountpoint="",target=""} 16
+`
+	if err := testutil.CollectAndCompare(h, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLatencyHistogramNative(t *testing.T) {
+	defer func() { nativeHistograms = false }()
+	nativeHistograms = true
+
+	h := newLatencyHistogram("test_latency_seconds", "Test latency")
+	h.Set(series{benchmark: "latency"}, time.Now(), testBins)
+
+	ch := make(chan prometheus.Metric, 1)
+	h.Collect(ch)
+	var m dto.Metric
+	if err := (<-ch).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	hist := m.GetHistogram()
+	if hist.GetSchema() != nativeHistogramSchema {
+		t.Errorf("got schema %d, want %d", hist.GetSchema(), nativeHistogramSchema)
+	}
+	if hist.GetSampleCount() != 16 {
+		t.Errorf("got count %d, want 16", hist.GetSampleCount())
+	}
+	var native int64
+	var count int64
+	for _, d := range hist.GetPositiveDelta() {
+		count += d
+		native += count
+	}
+	if native != 16 {
+		t.Errorf("got %d observations in native buckets, want 16", native)
+	}
+	if len(hist.GetBucket()) != len(latencyBuckets) {
+		t.Errorf("got %d classic buckets, want %d", len(hist.GetBucket()), len(latencyBuckets))
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fritchie/fio_benchmark_exporter/shellwords"
+)
+
+// benchmarkCommand is a fio command whose results are exported as benchmark
+type benchmarkCommand struct {
+	benchmark string
+	// args holds the command and its arguments, fio is run without a shell
+	args []string
+	// runtime is the time fio is expected to run for, 0 if unknown
+	runtime time.Duration
+	// files are glob patterns of the data files fio lays out
+	files []string
+	// jobs are the fio jobs of the command
+	jobs []fioJob
+	// fileSize is resolved before every run, nil for fixed sizes
+	fileSize *autoFileSize
+	// target is the directory or block device a predefined benchmark runs
+	// against, empty for custom benchmarks and job files
+	target string
+	// mount is the mount holding target, known for discovered targets and
+	// resolved before every run for the others
+	mount mount
+	// discovered is set for targets on discovered mounts, their data file
+	// directory is created by the exporter
+	discovered bool
+}
+
+// series returns the series of the runs of the command
+func (bc benchmarkCommand) series() series {
+	return series{
+		benchmark:  bc.benchmark,
+		target:     bc.target,
+		mountpoint: bc.mount.mountpoint,
+		fstype:     bc.mount.fstype,
+		device:     bc.mount.device,
+	}
+}
+
+// String returns the command line as it would be typed in a shell
+func (bc benchmarkCommand) String() string {
+	return shellwords.Join(bc.args)
+}
+
+// jobFiles returns the fio job files at path, path is either a job file or
+// a directory holding job files with the .fio extension
+func jobFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	files, err := filepath.Glob(filepath.Join(path, "*.fio"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .fio job files in %s", path)
+	}
+	return files, nil
+}
+
+// jobSection is a job section of a fio job file
+type jobSection struct {
+	name string
+	// args holds the options of the global sections and of the section as
+	// fio arguments, starting with --name
+	args []string
+}
+
+// jobFileSections returns the job sections of a fio job file, the global
+// section only holds defaults for the other sections
+func jobFileSections(path string) ([]jobSection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sections []jobSection
+	var global []string
+	// cur is nil until the first section
+	var cur *[]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			switch name {
+			case "":
+				cur = nil
+			case "global":
+				cur = &global
+			default:
+				// a global section only applies to the sections after it
+				args := append([]string{"--name=" + name}, global...)
+				sections = append(sections, jobSection{name: name, args: args})
+				cur = &sections[len(sections)-1].args
+			}
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		opt := "--" + strings.TrimSpace(key)
+		if ok {
+			opt += "=" + strings.TrimSpace(value)
+		}
+		*cur = append(*cur, opt)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("no job sections in %s", path)
+	}
+	return sections, nil
+}
+
+// jobFileCommands returns a benchmark for every job section of the job
+// files at path. Fio runs one section at a time with --section, the fio
+// flags are given before the job file so they act as global defaults.
+func jobFileCommands(path string, fioFlags []string) ([]benchmarkCommand, error) {
+	files, err := jobFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	var commands []benchmarkCommand
+	seen := make(map[string]string)
+	for _, file := range files {
+		sections, err := jobFileSections(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, section := range sections {
+			// sections are exported by name, they must be unique
+			if other, ok := seen[section.name]; ok {
+				return nil, fmt.Errorf("job section %s is in both %s and %s", section.name, other, file)
+			}
+			seen[section.name] = file
+			args := append([]string{"fio"}, fioFlags...)
+			commands = append(commands, benchmarkCommand{
+				benchmark: section.name,
+				args:      append(args, "--section="+section.name, file),
+				runtime:   fioArgsRuntime(section.args),
+				files:     fioArgsFiles(section.args),
+				jobs:      parseFioJobs(section.args),
+			})
+		}
+	}
+	return commands, nil
+}
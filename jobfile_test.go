@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJobFileCommands(t *testing.T) {
+	dir := filepath.Join("testdata", "jobs")
+	fioFlags := []string{"--output-format=json"}
+	commands, err := jobFileCommands(dir, fioFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []benchmarkCommand{
+		{
+			benchmark: "randread-4k",
+			args:      []string{"fio", "--output-format=json", "--section=randread-4k", filepath.Join(dir, "randrw.fio")},
+			runtime:   time.Minute,
+			files:     []string{"/tmp/randread-4k.[0-9]*.[0-9]*"},
+			jobs:      []fioJob{{name: "randread-4k", directory: "/tmp", size: "1G", numjobs: 1}},
+		},
+		{
+			benchmark: "randwrite-4k",
+			args:      []string{"fio", "--output-format=json", "--section=randwrite-4k", filepath.Join(dir, "randrw.fio")},
+			runtime:   time.Minute,
+			files:     []string{"/tmp/randwrite-4k.[0-9]*.[0-9]*"},
+			jobs:      []fioJob{{name: "randwrite-4k", directory: "/tmp", size: "1G", numjobs: 1}},
+		},
+		{
+			benchmark: "seqread-1m",
+			args:      []string{"fio", "--output-format=json", "--section=seqread-1m", filepath.Join(dir, "seq.fio")},
+			runtime:   time.Minute,
+			files:     []string{"/tmp/seqread-1m.[0-9]*.[0-9]*"},
+			jobs:      []fioJob{{name: "seqread-1m", directory: "/tmp", size: "1G", numjobs: 1}},
+		},
+	}
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("got %v, want %v", commands, want)
+	}
+
+	// a single job file
+	commands, err = jobFileCommands(filepath.Join(dir, "seq.fio"), fioFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(commands, want[2:]) {
+		t.Errorf("got %v, want %v", commands, want[2:])
+	}
+}
+
+func TestJobFileCommandsErrors(t *testing.T) {
+	tmp := t.TempDir()
+	if _, err := jobFileCommands(tmp, nil); err == nil {
+		t.Error("directory without job files: expected error")
+	}
+
+	global := filepath.Join(tmp, "global.fio")
+	if err := os.WriteFile(global, []byte("[global]\nbs=4k\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jobFileCommands(global, nil); err == nil {
+		t.Error("job file without job sections: expected error")
+	}
+
+	dup := filepath.Join(tmp, "dup")
+	if err := os.Mkdir(dup, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.fio", "b.fio"} {
+		if err := os.WriteFile(filepath.Join(dup, name), []byte("[job]\nbs=4k\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := jobFileCommands(dup, nil); err == nil {
+		t.Error("duplicate job sections: expected error")
+	}
+}
+
+func TestJobFileCommandsRuntime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runtime.fio")
+	jobs := `[global]
+runtime=2m
+ramp_time=10s
+directory=/data
+
+[default]
+bs=4k
+
+; a job with its own runtime and file
+[own]
+runtime=30
+filename=own.dat
+
+[global]
+runtime=0
+
+[untimed]
+filename=/dev/sdb:/data/b
+`
+	if err := os.WriteFile(path, []byte(jobs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	commands, err := jobFileCommands(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		runtime time.Duration
+		files   []string
+	}{
+		{2*time.Minute + 10*time.Second, []string{"/data/default.[0-9]*.[0-9]*"}},
+		{40 * time.Second, nil},
+		{0, nil},
+	}
+	if len(commands) != len(want) {
+		t.Fatalf("got %d commands, want %d", len(commands), len(want))
+	}
+	for i, bc := range commands {
+		if bc.runtime != want[i].runtime || !reflect.DeepEqual(bc.files, want[i].files) {
+			t.Errorf("%s: got runtime %s, files %q, want %s, %q", bc.benchmark, bc.runtime, bc.files, want[i].runtime, want[i].files)
+		}
+	}
+}
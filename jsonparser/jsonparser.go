@@ -0,0 +1,294 @@
+// Package jsonparser decodes fio JSON output (--output-format=json or json+)
+//
+// Stats are decoded by key into structs mirroring the fio JSON document and
+// can be converted to the terseparser.Result used by the exporter, so both
+// output formats export the same metrics.
+package jsonparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fritchie/fio_benchmark_exporter/terseparser"
+)
+
+// Latency holds latency statistics (nsec)
+type Latency struct {
+	Min        float64            `json:"min"`
+	Max        float64            `json:"max"`
+	Mean       float64            `json:"mean"`
+	Stddev     float64            `json:"stddev"`
+	N          float64            `json:"N"`
+	Percentile map[string]float64 `json:"percentile"`
+	// Bins maps latency (nsec) to a count of IOs, json+ output only
+	Bins map[string]uint64 `json:"bins"`
+}
+
+// IOStats holds the stats for one data direction (read, write or trim)
+type IOStats struct {
+	IOKBytes    float64 `json:"io_kbytes"`
+	BW          float64 `json:"bw"`
+	IOPS        float64 `json:"iops"`
+	Runtime     float64 `json:"runtime"`
+	TotalIOs    float64 `json:"total_ios"`
+	SlatNs      Latency `json:"slat_ns"`
+	ClatNs      Latency `json:"clat_ns"`
+	LatNs       Latency `json:"lat_ns"`
+	BWMin       float64 `json:"bw_min"`
+	BWMax       float64 `json:"bw_max"`
+	BWAgg       float64 `json:"bw_agg"`
+	BWMean      float64 `json:"bw_mean"`
+	BWDev       float64 `json:"bw_dev"`
+	BWSamples   float64 `json:"bw_samples"`
+	IOPSMin     float64 `json:"iops_min"`
+	IOPSMax     float64 `json:"iops_max"`
+	IOPSMean    float64 `json:"iops_mean"`
+	IOPSStddev  float64 `json:"iops_stddev"`
+	IOPSSamples float64 `json:"iops_samples"`
+}
+
+// Job holds the stats of a single job, or of all jobs in a group when fio
+// is run with --group_reporting
+type Job struct {
+	JobName         string             `json:"jobname"`
+	GroupID         int                `json:"groupid"`
+	Error           int                `json:"error"`
+	Description     string             `json:"desc"`
+	TotalErr        int64              `json:"total_err"`
+	FirstError      int                `json:"first_error"`
+	Read            IOStats            `json:"read"`
+	Write           IOStats            `json:"write"`
+	Trim            IOStats            `json:"trim"`
+	UsrCPU          float64            `json:"usr_cpu"`
+	SysCPU          float64            `json:"sys_cpu"`
+	Ctx             float64            `json:"ctx"`
+	Majf            float64            `json:"majf"`
+	Minf            float64            `json:"minf"`
+	IODepthLevel    map[string]float64 `json:"iodepth_level"`
+	IODepthSubmit   map[string]float64 `json:"iodepth_submit"`
+	IODepthComplete map[string]float64 `json:"iodepth_complete"`
+	LatencyNs       map[string]float64 `json:"latency_ns"`
+	LatencyUs       map[string]float64 `json:"latency_us"`
+	LatencyMs       map[string]float64 `json:"latency_ms"`
+}
+
+// DiskUtil holds the utilization stats of one disk
+type DiskUtil struct {
+	Name        string  `json:"name"`
+	ReadIOs     float64 `json:"read_ios"`
+	WriteIOs    float64 `json:"write_ios"`
+	ReadMerges  float64 `json:"read_merges"`
+	WriteMerges float64 `json:"write_merges"`
+	ReadTicks   float64 `json:"read_ticks"`
+	WriteTicks  float64 `json:"write_ticks"`
+	InQueue     float64 `json:"in_queue"`
+	Util        float64 `json:"util"`
+}
+
+// Output is a complete fio JSON document
+type Output struct {
+	FioVersion string     `json:"fio version"`
+	Jobs       []Job      `json:"jobs"`
+	DiskUtil   []DiskUtil `json:"disk_util"`
+}
+
+// Decoder reads consecutive fio JSON documents from a stream, fio prints
+// one document per --status-interval update
+type Decoder struct {
+	dec *json.Decoder
+}
+
+// NewDecoder returns a Decoder reading from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{dec: json.NewDecoder(r)}
+}
+
+// Decode returns the next fio JSON document, or io.EOF at the end of the
+// stream
+func (d *Decoder) Decode() (*Output, error) {
+	var o Output
+	if err := d.dec.Decode(&o); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(o.FioVersion, "fio-") {
+		return nil, fmt.Errorf("document is not fio JSON output, \"fio version\" is %q", o.FioVersion)
+	}
+	return &o, nil
+}
+
+// Parse decodes a single fio JSON document
+func Parse(data []byte) (*Output, error) {
+	var o Output
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// Results converts every job in the document to a terseparser.Result
+func (o *Output) Results() ([]*terseparser.Result, error) {
+	results := make([]*terseparser.Result, 0, len(o.Jobs))
+	for i := range o.Jobs {
+		r, err := o.result(&o.Jobs[i])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func (o *Output) result(j *Job) (*terseparser.Result, error) {
+	r := &terseparser.Result{
+		FioVersion:  strings.TrimPrefix(o.FioVersion, "fio-"),
+		JobName:     j.JobName,
+		GroupID:     j.GroupID,
+		Error:       j.Error,
+		TotalErrors: j.TotalErr,
+		FirstError:  j.FirstError,
+		Description: j.Description,
+		CPU: terseparser.CPU{
+			User:            j.UsrCPU,
+			System:          j.SysCPU,
+			ContextSwitches: j.Ctx,
+			MajorFaults:     j.Majf,
+			MinorFaults:     j.Minf,
+		},
+	}
+
+	sections := []struct {
+		name string
+		in   *IOStats
+		out  *terseparser.IOStats
+	}{
+		{"read", &j.Read, &r.Read},
+		{"write", &j.Write, &r.Write},
+		{"trim", &j.Trim, &r.Trim},
+	}
+	for _, s := range sections {
+		if err := s.in.convert(s.out); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.name, err)
+		}
+	}
+
+	r.IODepth = buckets(j.IODepthLevel, terseparser.IODepthLabels)
+	r.IODepthSubmit = buckets(j.IODepthSubmit, terseparser.IODepthSubmitLabels)
+	r.IODepthComplete = buckets(j.IODepthComplete, terseparser.IODepthSubmitLabels)
+	r.LatencyUs = buckets(j.LatencyUs, terseparser.LatencyUsLabels)
+	r.LatencyMs = buckets(j.LatencyMs, terseparser.LatencyMsLabels)
+	// terse output folds the nanosecond buckets into the first microsecond
+	// bucket, do the same so both formats report the same distribution
+	for _, v := range j.LatencyNs {
+		r.LatencyUs[0].Percent += v
+	}
+
+	for _, d := range o.DiskUtil {
+		r.Disks = append(r.Disks, terseparser.DiskUtil{
+			Name:        d.Name,
+			ReadIOs:     d.ReadIOs,
+			WriteIOs:    d.WriteIOs,
+			ReadMerges:  d.ReadMerges,
+			WriteMerges: d.WriteMerges,
+			ReadTicks:   d.ReadTicks,
+			WriteTicks:  d.WriteTicks,
+			InQueue:     d.InQueue,
+			Util:        d.Util,
+		})
+	}
+
+	return r, nil
+}
+
+// buckets orders a JSON percentage distribution like terse output
+func buckets(m map[string]float64, labels []string) []terseparser.Bucket {
+	b := make([]terseparser.Bucket, 0, len(labels))
+	for _, l := range labels {
+		b = append(b, terseparser.Bucket{Label: l, Percent: m[l]})
+	}
+	return b
+}
+
+func (s *IOStats) convert(out *terseparser.IOStats) error {
+	out.TotalIO = s.IOKBytes
+	out.Bandwidth = s.BW
+	out.IOPS = s.IOPS
+	out.Runtime = s.Runtime
+	out.Slat = s.SlatNs.usec()
+	out.Clat = s.ClatNs.usec()
+	out.Lat = s.LatNs.usec()
+	out.BandwidthStats = terseparser.BandwidthStats{
+		Min:        s.BWMin,
+		Max:        s.BWMax,
+		AggPercent: s.BWAgg,
+		Mean:       s.BWMean,
+		Stddev:     s.BWDev,
+		Samples:    s.BWSamples,
+	}
+	out.IOPSStats = terseparser.IOPSStats{
+		Min:     s.IOPSMin,
+		Max:     s.IOPSMax,
+		Mean:    s.IOPSMean,
+		Stddev:  s.IOPSStddev,
+		Samples: s.IOPSSamples,
+	}
+
+	// same as terse output, total latency percentiles with
+	// --lat_percentiles=1 and completion latency percentiles otherwise
+	percentiles, bins := s.LatNs.Percentile, s.LatNs.Bins
+	if len(percentiles) == 0 {
+		percentiles, bins = s.ClatNs.Percentile, s.ClatNs.Bins
+	}
+	var err error
+	if out.Percentiles, err = convertPercentiles(percentiles); err != nil {
+		return err
+	}
+	if out.ClatPercentiles, err = convertPercentiles(s.ClatNs.Percentile); err != nil {
+		return err
+	}
+	out.Bins, err = convertBins(bins)
+	return err
+}
+
+// usec converts nsec latency to the usec used by terse output
+func (l *Latency) usec() terseparser.Latency {
+	return terseparser.Latency{
+		Min:    l.Min / 1000,
+		Max:    l.Max / 1000,
+		Mean:   l.Mean / 1000,
+		Stddev: l.Stddev / 1000,
+	}
+}
+
+func convertPercentiles(m map[string]float64) ([]terseparser.Percentile, error) {
+	var percentiles []terseparser.Percentile
+	for k, v := range m {
+		p, err := strconv.ParseFloat(k, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percentile %q: %w", k, err)
+		}
+		percentiles = append(percentiles, terseparser.Percentile{Percentile: p, Value: v / 1000})
+	}
+	sort.Slice(percentiles, func(i, j int) bool {
+		return percentiles[i].Percentile < percentiles[j].Percentile
+	})
+	return percentiles, nil
+}
+
+func convertBins(m map[string]uint64) ([]terseparser.Bin, error) {
+	var bins []terseparser.Bin
+	for k, v := range m {
+		ns, err := strconv.ParseFloat(k, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latency bin %q: %w", k, err)
+		}
+		bins = append(bins, terseparser.Bin{Value: ns / 1000, Count: v})
+	}
+	sort.Slice(bins, func(i, j int) bool {
+		return bins[i].Value < bins[j].Value
+	})
+	return bins, nil
+}
@@ -0,0 +1,158 @@
+package jsonparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fritchie/fio_benchmark_exporter/terseparser"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestResultsGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no testdata found")
+	}
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".json")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			o, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Parse: %s", err)
+			}
+			results, err := o.Results()
+			if err != nil {
+				t.Fatalf("Results: %s", err)
+			}
+			got, err := json.MarshalIndent(results, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("results do not match %s, run with -update to regenerate\ngot:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+// TestMatchesTerse checks the JSON and terse output of the same run
+// convert to the same result
+func TestMatchesTerse(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "latency.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := o.Results()
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := os.ReadFile(filepath.Join("..", "terseparser", "testdata", "latency.terse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := terseparser.Parse(strings.TrimSpace(string(line)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	// terse output pads percentiles of an idle direction with zeroes, JSON
+	// output omits them
+	results[0].Trim.Percentiles = nil
+	want.Trim.Percentiles = nil
+	// terse output does not include the submit and complete depths
+	results[0].IODepthSubmit = nil
+	results[0].IODepthComplete = nil
+	if !equalApprox(reflect.ValueOf(*results[0]), reflect.ValueOf(*want)) {
+		t.Errorf("JSON result differs from terse result\ngot:  %+v\nwant: %+v", *results[0], *want)
+	}
+}
+
+// equalApprox is reflect.DeepEqual with a tolerance for the rounding of
+// nsec to usec conversions
+func equalApprox(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Float64:
+		return math.Abs(a.Float()-b.Float()) < 1e-9
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !equalApprox(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equalApprox(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a.Interface(), b.Interface())
+	}
+}
+
+func TestDecoderStatusUpdates(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "latency.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fio prints one document per --status-interval update
+	d := NewDecoder(bytes.NewReader(bytes.Repeat(data, 3)))
+	n := 0
+	for {
+		_, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Decode: %s", err)
+		}
+		n++
+	}
+	if n != 3 {
+		t.Errorf("got %d documents, want 3", n)
+	}
+
+	d = NewDecoder(strings.NewReader(`{"jobs": []}`))
+	if _, err := d.Decode(); err == nil {
+		t.Error("document without fio version: expected error")
+	}
+}
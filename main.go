@@ -10,6 +10,9 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -17,767 +20,388 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/fritchie/fio_benchmark_exporter/jsonparser"
+	"github.com/fritchie/fio_benchmark_exporter/terseparser"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/robfig/cron/v3"
 )
 
-var labels = []string{"benchmark"}
-
-var (
-	promRegistry = prometheus.NewRegistry()
-	// START METRICS
-	fioReadBW = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_read_bandwidth_kbps",
-			Help: "Read bandwidth (KiB/s)",
-		},
-		labels,
-	)
-	fioReadIOPS = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_read_iops",
-			Help: "Read IOPS",
-		},
-		labels,
-	)
-	fioReadLat90 = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_read_lat_pct90",
-			Help: "Read total latency 90th percentile (usec)",
-		},
-		labels,
-	)
-	fioReadLat95 = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_read_lat_pct95",
-			Help: "Read total latency 95th percentile (usec)",
-		},
-		labels,
-	)
-	fioReadLat99 = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_read_lat_pct99",
-			Help: "Read total latency 99th percentile (usec)",
-		},
-		labels,
-	)
-	fioReadLatMin = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_read_lat_min",
-			Help: "Read total latency minimum (usec)",
-		},
-		labels,
-	)
-	fioReadLatMax = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_read_lat_max",
-			Help: "Read total latency maximum (usec)",
-		},
-		labels,
-	)
-	fioReadLatMean = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_read_lat_mean",
-			Help: "Read total latency mean (usec)",
-		},
-		labels,
-	)
-	fioReadBWMin = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_read_bw_min_kb",
-			Help: "Read bandwidth minimum (KiB/s)",
-		},
-		labels,
-	)
-	fioReadBWMax = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_read_bw_max_kb",
-			Help: "Read bandwidth maximum (KiB/s)",
-		},
-		labels,
-	)
-	fioReadBWMean = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_read_bw_mean_kb",
-			Help: "Read bandwidth mean (KiB/s)",
-		},
-		labels,
-	)
-	fioReadIOPSMin = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_read_iops_min",
-			Help: "Read IOPS minimum",
-		},
-		labels,
-	)
-	fioReadIOPSMax = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_read_iops_max",
-			Help: "Read IOPS maximum",
-		},
-		labels,
-	)
-	fioReadIOPSMean = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_read_iops_mean",
-			Help: "Read IOPS mean",
-		},
-		labels,
-	)
-	fioWriteBW = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_write_bandwidth_kbps",
-			Help: "Write bandwidth (KiB/s)",
-		},
-		labels,
-	)
-	fioWriteIOPS = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_write_iops",
-			Help: "Write IOPS",
-		},
-		labels,
-	)
-	fioWriteLat90 = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_write_lat_pct90",
-			Help: "Write total latency 90th percentile (usec)",
-		},
-		labels,
-	)
-	fioWriteLat95 = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_write_lat_pct95",
-			Help: "Write total latency 95th percentile (usec)",
-		},
-		labels,
-	)
-	fioWriteLat99 = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_write_lat_pct99",
-			Help: "Write total latency 99th percentile (usec)",
-		},
-		labels,
-	)
-	fioWriteLatMin = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_write_lat_min",
-			Help: "Write total latency minimum (usec)",
-		},
-		labels,
-	)
-	fioWriteLatMax = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_write_lat_max",
-			Help: "Write total latency maximum (usec)",
-		},
-		labels,
-	)
-	fioWriteLatMean = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_write_lat_mean",
-			Help: "Read total latency mean (usec)",
-		},
-		labels,
-	)
-	fioWriteBWMin = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_write_bw_min_kb",
-			Help: "Write bandwidth minimum (KiB/s)",
-		},
-		labels,
-	)
-	fioWriteBWMax = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_write_bw_max_kb",
-			Help: "Write bandwidth maximum (KiB/s)",
-		},
-		labels,
-	)
-	fioWriteBWMean = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_write_bw_mean_kb",
-			Help: "Write bandwidth mean (KiB/s)",
-		},
-		labels,
-	)
-	fioWriteIOPSMin = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_write_iops_min",
-			Help: "Write IOPS minimum",
-		},
-		labels,
-	)
-	fioWriteIOPSMax = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_write_iops_max",
-			Help: "Write IOPS maximum",
-		},
-		labels,
-	)
-	fioWriteIOPSMean = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_write_iops_mean",
-			Help: "Write IOPS mean",
-		},
-		labels,
-	)
-	fioCpuUser = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_cpu_user",
-			Help: "User CPU utilization (%)",
-		},
-		labels,
-	)
-	fioCpuSys = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_cpu_sys",
-			Help: "System CPU utilization (%)",
-		},
-		labels,
-	)
-	fioIODepth1 = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_iodepth_1",
-			Help: "Queue depth <=1 (%)",
-		},
-		labels,
-	)
-	fioIODepth2 = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_iodepth_2",
-			Help: "Queue depth 2 (%)",
-		},
-		labels,
-	)
-	fioIODepth4 = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_iodepth_4",
-			Help: "Queue depth 4 (%)",
-		},
-		labels,
-	)
-	fioIODepth8 = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_iodepth_8",
-			Help: "Queue depth 8 (%)",
-		},
-		labels,
-	)
-	fioIODepth16 = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_iodepth_16",
-			Help: "Queue depth 16 (%)",
-		},
-		labels,
-	)
-	fioIODepth32 = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_iodepth_32",
-			Help: "Queue depth 32 (%)",
-		},
-		labels,
-	)
-	fioIODepth64 = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_iodepth_64",
-			Help: "Queue depth 64+ (%)",
-		},
-		labels,
-	)
-	fioBenchmarkSuccess = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "fio_benchmark_success",
-			Help: "1 if last benchmark was successful, 0 otherwise",
-		},
-		labels,
-	)
-	// END METRICS
-)
-
-func init() {
-	promRegistry.MustRegister(
-		fioReadBW,
-		fioReadIOPS,
-		fioReadLat90,
-		fioReadLat95,
-		fioReadLat99,
-		fioReadLatMin,
-		fioReadLatMax,
-		fioReadLatMean,
-		fioReadBWMin,
-		fioReadBWMax,
-		fioReadBWMean,
-		fioReadIOPSMin,
-		fioReadIOPSMax,
-		fioReadIOPSMean,
-		fioWriteBW,
-		fioWriteIOPS,
-		fioWriteLat90,
-		fioWriteLat95,
-		fioWriteLat99,
-		fioWriteLatMin,
-		fioWriteLatMax,
-		fioWriteLatMean,
-		fioWriteBWMin,
-		fioWriteBWMax,
-		fioWriteBWMean,
-		fioWriteIOPSMin,
-		fioWriteIOPSMax,
-		fioWriteIOPSMean,
-		fioCpuUser,
-		fioCpuSys,
-		fioIODepth1,
-		fioIODepth2,
-		fioIODepth4,
-		fioIODepth8,
-		fioIODepth16,
-		fioIODepth32,
-		fioIODepth64,
-		fioBenchmarkSuccess,
-	)
-}
-
 func main() {
 	// START FLAGS
+	allowRawDevices := flag.Bool("allowRawDevices", false, "allow block devices as targets, fio overwrites their data")
+	allowTmpfs := flag.Bool("allowTmpfs", false, "allow benchmark directories on tmpfs")
 	benchmark := flag.String("benchmark", "latency", "iops, latency or throughput")
 	benchmarkRuntime := flag.String("benchmarkRuntime", "60", "runtime for benchmark in seconds")
+	var benchmarkSpecs benchmarkSpecFlag
+	flag.Var(&benchmarkSpecs, "benchmarkSpec", "semicolon separated key=value benchmark settings, e.g. name=nightly;benchmark=throughput;cronSchedule=0 2 * * *, repeat for multiple benchmarks")
+	checkConfig := flag.Bool("checkConfig", false, "validate the configuration and exit")
+	configFile := flag.String("config", "", "YAML or JSON config file, overrides flags")
+	configReloadInterval := flag.Duration("configReloadInterval", 0, "reload the config file when it changes, checking at this interval, 0 disables")
 	cronSchedule := flag.String("cronSchedule", "0 */6 * * *", "crontab formatted schedule")
 	customBenchmarkFioFlags := flag.String("customBenchmarkFioFlags", "", "experts only")
 	directory := flag.String("directory", "/tmp", "absolute path to directory to use for benchmark files")
-	fileSize := flag.String("fileSize", "1G", "size of file to use for benchmark")
+	discoverFstypes := flag.String("discoverFstypes", "ext4,xfs", "comma separated filesystem types of discovered mounts, any if empty")
+	discoverMinSize := flag.String("discoverMinSize", "", "smallest filesystem size of discovered mounts, a fio size")
+	discoverMountpoints := flag.String("discoverMountpoints", "", "glob of the mount points to benchmark, e.g. /mnt/*, replaces directory and targets")
+	fileSize := flag.String("fileSize", "1G", "size of file to use for benchmark, a fio size, free:<percent>% of the free space or ram:<multiple>x of the RAM")
+	fileSizeMax := flag.String("fileSizeMax", "", "largest file size a free: or ram: fileSize resolves to")
+	fileSizeMin := flag.String("fileSizeMin", "", "smallest file size a free: or ram: fileSize resolves to")
+	freeSpaceMargin := flag.String("freeSpaceMargin", "5%", "space the data files must leave free, a fio size or a percentage of the filesystem size")
+	jobFile := flag.String("jobFile", "", "fio job file, or directory of .fio job files, every job section is run as a benchmark")
+	keepDataFiles := flag.Bool("keepDataFiles", false, "keep the files fio lays out for the next run instead of removing them after every run")
+	flag.BoolVar(&nativeHistograms, "nativeHistograms", false, "add native histogram buckets to latency histograms")
+	outputFormat := flag.String("outputFormat", "terse", "fio output format, terse, json or json+")
+	perJob := flag.Bool("perJob", false, "export the stats of every fio job instead of the group stats")
 	port := flag.String("port", "9996", "tcp listen port")
+	retryAttempts := flag.Int("retryAttempts", 0, "retry a failed benchmark this many times before waiting for its next scheduled run")
+	retryBackoff := flag.Duration("retryBackoff", 1*time.Minute, "wait this duration before the first retry of a failed benchmark, doubled for every retry")
 	runOnce := flag.Bool("runOnce", false, "exit after benchmark complete and runOnceWait has expired")
-	runOnceWait := flag.Duration("runOnceWait", 1 * time.Hour, "wait this duration before exiting a runOnce benchmark")
+	runOnceWait := flag.Duration("runOnceWait", 1*time.Hour, "wait this duration before exiting a runOnce benchmark")
+	runTimeout := flag.Duration("runTimeout", 0, "kill fio after this duration, 0 allows the benchmark runtime plus runTimeoutGrace")
+	runTimeoutGrace := flag.Duration("runTimeoutGrace", 10*time.Minute, "time allowed on top of the benchmark runtime for file layout and reporting before fio is killed")
+	shutdownTimeout := flag.Duration("shutdownTimeout", 25*time.Second, "time allowed on SIGTERM or SIGINT to stop fio, remove its data files and close the HTTP server")
 	skipInitialBenchmark := flag.Bool("skipInitialBenchmark", false, "skip initial benchmark when app first starts")
 	statusUpdates := flag.Bool("statusUpdates", false, "update metrics every statusUpdateTime seconds during benchmark")
 	statusUpdateInterval := flag.String("statusUpdateInterval", "30", "metric update interval in seconds when statusUpdates enabled")
+	targets := flag.String("targets", "", "comma separated directories or block devices to benchmark in turn, replaces directory")
 	flag.Parse()
 	// END FLAGS
 
-	var fioBenchmarkFlags string
-	switch *benchmark {
-	case "iops":
-		fioBenchmarkFlags = "--name=iops --numjobs=4 --ioengine=libaio --direct=1 --bs=4k --iodepth=128 --readwrite=randrw"
-	case "latency":
-		fioBenchmarkFlags = "--name=latency --numjobs=1 --ioengine=libaio --direct=1 --bs=4k --iodepth=1 --readwrite=randrw"
-	case "throughput":
-		fioBenchmarkFlags = "--name=throughput --numjobs=4 --ioengine=libaio --direct=1 --bs=128k --iodepth=64 --readwrite=rw"
-	case "custom":
-		break
-	default:
-		fioBenchmarkFlags = "--name=latency --numjobs=1 --ioengine=libaio --direct=1 --bs=4k --iodepth=1 --readwrite=randrw"
-	}
-
-	// make sure custom fio flags supplied for custom benchmark
-	if *benchmark == "custom" && *customBenchmarkFioFlags == "" {
-		log.Fatal("customBenchmarkFioFlags must be used when benchmark is custom")
-	}
-
-	// fio terse version 5 output used for all benchmarks
-	// custom benchmarks cannot use the --output-format or --output flags
-	if *benchmark == "custom" && strings.Contains(*customBenchmarkFioFlags, "output") {
-		log.Fatal("customBenchmarkFioFlags cannot contain the flag --output-format or --output")
+	// the benchmark flags configure a single benchmark, or the defaults of
+	// the benchmarks configured with benchmarkSpec or the config file
+	defaults := benchmarkSpec{
+		Name:                    *benchmark,
+		Benchmark:               *benchmark,
+		BenchmarkRuntime:        *benchmarkRuntime,
+		CronSchedule:            *cronSchedule,
+		CustomBenchmarkFioFlags: *customBenchmarkFioFlags,
+		Directory:               *directory,
+		FileSize:                *fileSize,
+		FileSizeMin:             *fileSizeMin,
+		FileSizeMax:             *fileSizeMax,
+		JobFile:                 *jobFile,
+		Targets:                 splitList(*targets),
+		flagTargets:             true,
 	}
-
-	// make sure custom benchmark does not include any percentile related flags
-	if *benchmark == "custom" && strings.Contains(*customBenchmarkFioFlags, "percentile") {
-		log.Fatal("customBenchmarkFioFlags cannot contain any percentile related flags")
+	base := config{
+		OutputFormat:         *outputFormat,
+		PerJob:               *perJob,
+		NativeHistograms:     nativeHistograms,
+		StatusUpdates:        *statusUpdates,
+		StatusUpdateInterval: *statusUpdateInterval,
+		RunOnce:              *runOnce,
+		RunOnceWait:          *runOnceWait,
+		SkipInitialBenchmark: *skipInitialBenchmark,
+		FreeSpaceMargin:      *freeSpaceMargin,
+		AllowTmpfs:           *allowTmpfs,
+		AllowRawDevices:      *allowRawDevices,
+		KeepDataFiles:        *keepDataFiles,
+		RunTimeout:           *runTimeout,
+		RunTimeoutGrace:      *runTimeoutGrace,
+		ShutdownTimeout:      *shutdownTimeout,
+		RetryAttempts:        *retryAttempts,
+		RetryBackoff:         *retryBackoff,
+		HTTP: httpConfig{
+			ListenAddress: ":" + *port,
+			MetricsPath:   "/metrics",
+		},
+		Discovery: discoveryConfig{
+			Mountpoints: *discoverMountpoints,
+			Fstypes:     splitList(*discoverFstypes),
+			MinSize:     *discoverMinSize,
+		},
+		Benchmarks: []benchmarkSpec{defaults},
 	}
-
-	// make sure runOnce and skipInitialBenchmark are not both true
-	if *runOnce && *skipInitialBenchmark {
-		log.Fatalln("The runOnce and skipInitialBenchmark flags cannot be used at the same time")
-	}
-
-	go func() {
-		ch := make(chan struct{}, 1)
-
-		// create cron if needed
-		if !*runOnce {
-			c := cron.New()
-			_, err := c.AddFunc(*cronSchedule, func() { if len(ch) == 0 { log.Println("Cron sending message to ch"); ch <- struct{}{} }})
+	if len(benchmarkSpecs) > 0 {
+		base.Benchmarks = base.Benchmarks[:0]
+		for _, s := range benchmarkSpecs {
+			spec, err := parseBenchmarkSpec(s, defaults)
 			if err != nil {
-				log.Fatalf("Invalid cronSchedule: %s: %s\n", *cronSchedule, err)
+				log.Fatalln(err)
 			}
-			log.Printf("Configured schedule: %s\n", *cronSchedule)
-			c.Start()
-		}
-
-		if len(ch) == 0 && !*skipInitialBenchmark {
-			// send initial message
-			ch <- struct{}{}
+			base.Benchmarks = append(base.Benchmarks, spec)
 		}
+	}
 
-		for {
-			<-ch
-			var cmd string
-			if *benchmark != "custom" {
-				if !*statusUpdates {
-					cmd = fmt.Sprintf("fio %s --directory=%s --size=%s --runtime=%s --time_based --output-format=terse --terse-version=5 --lat_percentiles=1 --clat_percentiles=0 --group_reporting", fioBenchmarkFlags, *directory, *fileSize, *benchmarkRuntime)
-				} else {
-					cmd = fmt.Sprintf("fio %s --status-interval=%s --directory=%s --size=%s --runtime=%s --time_based --output-format=terse --terse-version=5 --lat_percentiles=1 --clat_percentiles=0 --group_reporting", fioBenchmarkFlags, *statusUpdateInterval, *directory, *fileSize, *benchmarkRuntime)
-				}
-			} else {
-				cmd = fmt.Sprintf("fio --output-format=terse --terse-version=5 --lat_percentiles=1 --clat_percentiles=0 --group_reporting %s", *customBenchmarkFioFlags)
+	// load reads the config file over the flags, on startup and on every
+	// reload
+	load := func() (*config, error) {
+		cfg := base
+		if *configFile != "" {
+			if err := loadConfig(*configFile, &cfg, defaults); err != nil {
+				return nil, err
 			}
+		}
+		return &cfg, cfg.validate()
+	}
 
-			log.Printf("Running fio: %s", cmd)
-			cmdParts := strings.Split(cmd, " ")
-			fioCommand := exec.Command(cmdParts[0], cmdParts[1:]...)
-			fioStdout, err := fioCommand.StdoutPipe()
-			if err != nil {
-				log.Fatalf("Error creating StdoutPipe: %s", err)
-			}
-			fioStderr, err := fioCommand.StderrPipe()
-			if err != nil {
-				log.Fatalf("Error creating StderrPipe: %s", err)
-			}
-			var fioStderrBytes []byte
-			go func() {
-				fioStderrBytes, _ = io.ReadAll(fioStderr)
-			}()
-			if err := fioCommand.Start(); err != nil {
-				log.Fatalf("Error starting fioCommand: %s", err)
-			}
-			scanner := bufio.NewScanner(fioStdout)
-			// fio terse output format provides all stats on a single line
-			scanner.Split(bufio.ScanLines)
-			for scanner.Scan() {
-				s := scanner.Text()
-				// check if line matches fio terse v5 signature
-				if s[0:6] != "5;fio-" {
-					log.Printf("Line does not have the fio terse v5 signature, skipping: %s\n", s[0:6])
-					continue
-				}
-				parts := strings.Split(s, ";")
-				log.Printf("Fio update: %s\n", parts)
-				fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(1)
-
-				// START PARSE
-				readBW, err := strconv.ParseFloat(parts[6], 64)
-				if err != nil {
-					log.Printf("Error parsing readBW (parts[6]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioReadBW.WithLabelValues(*benchmark).Set(readBW)
-				}
-
-				readIOPS, err := strconv.ParseFloat(parts[7], 64)
-				if err != nil {
-					log.Printf("Error parsing readIOPS (parts[7]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioReadIOPS.WithLabelValues(*benchmark).Set(readIOPS)
-				}
-
-				readLat90, err := strconv.ParseFloat(strings.Split(parts[27], "=")[1], 64)
-				if err != nil {
-					log.Printf("Error parsing readLat90 (parts[27]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioReadLat90.WithLabelValues(*benchmark).Set(readLat90)
-				}
-
-				readLat95, err := strconv.ParseFloat(strings.Split(parts[28], "=")[1], 64)
-				if err != nil {
-					log.Printf("Error parsing readLat95 (parts[28]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioReadLat95.WithLabelValues(*benchmark).Set(readLat95)
-				}
-
-				readLat99, err := strconv.ParseFloat(strings.Split(parts[29], "=")[1], 64)
-				if err != nil {
-					log.Printf("Error parsing readLat99 (parts[29]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioReadLat99.WithLabelValues(*benchmark).Set(readLat99)
-				}
-
-				readLatMin, err := strconv.ParseFloat(parts[37], 64)
-				if err != nil {
-					log.Printf("Error parsing readLatMin (parts[37]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioReadLatMin.WithLabelValues(*benchmark).Set(readLatMin)
-				}
-
-				readLatMax, err := strconv.ParseFloat(parts[38], 64)
-				if err != nil {
-					log.Printf("Error parsing readLatMax (parts[38]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioReadLatMax.WithLabelValues(*benchmark).Set(readLatMax)
-				}
-
-				readLatMean, err := strconv.ParseFloat(parts[39], 64)
-				if err != nil {
-					log.Printf("Error parsing readLatMean (parts[39]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioReadLatMean.WithLabelValues(*benchmark).Set(readLatMean)
-				}
-				readBWMin, err := strconv.ParseFloat(parts[41], 64)
-				if err != nil {
-					log.Printf("Error parsing readBWMin (parts[41]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioReadBWMin.WithLabelValues(*benchmark).Set(readBWMin)
-				}
-
-				readBWMax, err := strconv.ParseFloat(parts[42], 64)
-				if err != nil {
-					log.Printf("Error parsing readBWMax (parts[42]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioReadBWMax.WithLabelValues(*benchmark).Set(readBWMax)
-				}
-
-				readBWMean, err := strconv.ParseFloat(parts[44], 64)
-				if err != nil {
-					log.Printf("Error parsing readBWMean (parts[44]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioReadBWMean.WithLabelValues(*benchmark).Set(readBWMean)
-				}
-
-				readIOPSMin, err := strconv.ParseFloat(parts[47], 64)
-				if err != nil {
-					log.Printf("Error parsing readIOPSMin (parts[47]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioReadIOPSMin.WithLabelValues(*benchmark).Set(readIOPSMin)
-				}
-
-				readIOPSMax, err := strconv.ParseFloat(parts[48], 64)
-				if err != nil {
-					log.Printf("Error parsing readIOPSMax (parts[48]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioReadIOPSMax.WithLabelValues(*benchmark).Set(readIOPSMax)
-				}
-
-				readIOPSMean, err := strconv.ParseFloat(parts[49], 64)
-				if err != nil {
-					log.Printf("Error parsing readIOPSMean (parts[49]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioReadIOPSMean.WithLabelValues(*benchmark).Set(readIOPSMean)
-				}
-
-				writeBW, err := strconv.ParseFloat(parts[53], 64)
-				if err != nil {
-					log.Printf("Error parsing writeBW (parts[53]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioWriteBW.WithLabelValues(*benchmark).Set(writeBW)
-				}
-
-				writeIOPS, err := strconv.ParseFloat(parts[54], 64)
-				if err != nil {
-					log.Printf("Error parsing writeIOPS (parts[54]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioWriteIOPS.WithLabelValues(*benchmark).Set(writeIOPS)
-				}
-
-				writeLat90, err := strconv.ParseFloat(strings.Split(parts[74], "=")[1], 64)
-				if err != nil {
-					log.Printf("Error parsing writeLat90 (parts[74]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioWriteLat90.WithLabelValues(*benchmark).Set(writeLat90)
-				}
-
-				writeLat95, err := strconv.ParseFloat(strings.Split(parts[75], "=")[1], 64)
-				if err != nil {
-					log.Printf("Error parsing writeLat95 (parts[75]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioWriteLat95.WithLabelValues(*benchmark).Set(writeLat95)
-				}
-
-				writeLat99, err := strconv.ParseFloat(strings.Split(parts[76], "=")[1], 64)
-				if err != nil {
-					log.Printf("Error parsing writeLat99 (parts[76]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioWriteLat99.WithLabelValues(*benchmark).Set(writeLat99)
-				}
-
-				writeLatMin, err := strconv.ParseFloat(parts[84], 64)
-				if err != nil {
-					log.Printf("Error parsing writeLatMin (parts[84]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioWriteLatMin.WithLabelValues(*benchmark).Set(writeLatMin)
-				}
-
-				writeLatMax, err := strconv.ParseFloat(parts[85], 64)
-				if err != nil {
-					log.Printf("Error parsing writeLatMax (parts[85]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioWriteLatMax.WithLabelValues(*benchmark).Set(writeLatMax)
-				}
-
-				writeLatMean, err := strconv.ParseFloat(parts[86], 64)
-				if err != nil {
-					log.Printf("Error parsing writeLatMean (parts[86]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioWriteLatMean.WithLabelValues(*benchmark).Set(writeLatMean)
-				}
-
-				writeBWMin, err := strconv.ParseFloat(parts[88], 64)
-				if err != nil {
-					log.Printf("Error parsing writeBWMin (parts[88]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioWriteBWMin.WithLabelValues(*benchmark).Set(writeBWMin)
-				}
-
-				writeBWMax, err := strconv.ParseFloat(parts[89], 64)
-				if err != nil {
-					log.Printf("Error parsing writeBWMax (parts[89]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioWriteBWMax.WithLabelValues(*benchmark).Set(writeBWMax)
-				}
+	// report every problem of the config before anything runs
+	cfg, err := load()
+	if err != nil {
+		log.Fatalf("Invalid config:\n%s\n", err)
+	}
+	if *checkConfig {
+		log.Println("Config is valid")
+		os.Exit(0)
+	}
 
-				writeBWMean, err := strconv.ParseFloat(parts[91], 64)
-				if err != nil {
-					log.Printf("Error parsing writeBWMean (parts[91]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioWriteBWMean.WithLabelValues(*benchmark).Set(writeBWMean)
-				}
-				writeIOPSMin, err := strconv.ParseFloat(parts[94], 64)
-				if err != nil {
-					log.Printf("Error parsing writeIOPSMin (parts[94]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioWriteIOPSMin.WithLabelValues(*benchmark).Set(writeIOPSMin)
-				}
+	nativeHistograms = cfg.NativeHistograms
+	registerMetrics(prometheus.WrapRegistererWith(cfg.Labels, promRegistry))
 
-				writeIOPSMax, err := strconv.ParseFloat(parts[95], 64)
-				if err != nil {
-					log.Printf("Error parsing writeIOPSMax (parts[95]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioWriteIOPSMax.WithLabelValues(*benchmark).Set(writeIOPSMax)
-				}
+	// the exporter shuts down on SIGTERM or SIGINT, a second signal kills it
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-				writeIOPSMean, err := strconv.ParseFloat(parts[96], 64)
-				if err != nil {
-					log.Printf("Error parsing writeIOPSMean (parts[96]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioWriteIOPSMean.WithLabelValues(*benchmark).Set(writeIOPSMean)
-				}
+	r := newRunner()
+	if err := r.apply(cfg); err != nil {
+		log.Fatalln(err)
+	}
+	if !cfg.KeepDataFiles {
+		// files of runs interrupted by a crash are not reused
+		r.sweep()
+	}
+	if !cfg.SkipInitialBenchmark {
+		// queue initial runs
+		r.queueAll()
+	}
+	stopped := make(chan struct{})
+	go func() {
+		r.run(ctx)
+		close(stopped)
+	}()
 
-				cpuUser, err := strconv.ParseFloat(strings.Trim(parts[146], "%"), 64)
-				if err != nil {
-					log.Printf("Error parsing cpuUser (parts[146]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioCpuUser.WithLabelValues(*benchmark).Set(cpuUser)
-				}
+	rl := &reloader{load: load, runner: r}
+	go rl.handleSignals()
+	if *configFile != "" && *configReloadInterval > 0 {
+		go rl.watch(*configFile, *configReloadInterval)
+	}
 
-				cpuSys, err := strconv.ParseFloat(strings.Trim(parts[147], "%"), 64)
-				if err != nil {
-					log.Printf("Error parsing cpuSys (parts[147]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioCpuSys.WithLabelValues(*benchmark).Set(cpuSys)
-				}
+	http.Handle(cfg.HTTP.MetricsPath, promhttp.HandlerFor(
+		promRegistry,
+		promhttp.HandlerOpts{},
+	))
+	http.HandleFunc("/runs", runsHandler)
+	http.Handle("/-/reload", rl)
 
-				ioDepth1, err := strconv.ParseFloat(strings.Trim(parts[151], "%"), 64)
-				if err != nil {
-					log.Printf("Error: parsing ioDepth1 (parts[151]) %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioIODepth1.WithLabelValues(*benchmark).Set(ioDepth1)
-				}
+	server := &http.Server{Addr: cfg.HTTP.ListenAddress}
+	go func() {
+		log.Printf("Listening on %s\n", cfg.HTTP.ListenAddress)
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
 
-				ioDepth2, err := strconv.ParseFloat(strings.Trim(parts[152], "%"), 64)
-				if err != nil {
-					log.Printf("Error: parsing ioDepth2 (parts[152]) %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioIODepth2.WithLabelValues(*benchmark).Set(ioDepth2)
-				}
+	<-ctx.Done()
+	stop()
+	grace := r.config().ShutdownTimeout
+	log.Printf("Shutting down, waiting up to %s\n", grace)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	r.stop()
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		log.Println("Benchmark did not stop within shutdownTimeout")
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down HTTP server: %s\n", err)
+	}
+	log.Println("Shutdown complete")
+}
 
-				ioDepth4, err := strconv.ParseFloat(strings.Trim(parts[153], "%"), 64)
-				if err != nil {
-					log.Printf("Error parsing ioDepth4 (parts[153]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioIODepth4.WithLabelValues(*benchmark).Set(ioDepth4)
-				}
+// killWait is the time a fio command has to exit after it was killed, a
+// process stuck in uninterruptible IO outlives SIGKILL and is left behind
+var killWait = 30 * time.Second
+
+// errShutdown is returned for a fio command killed by a shutdown
+var errShutdown = errors.New("fio stopped by shutdown")
+
+// runBenchmark runs a fio command and exports its results, a failed run
+// is recorded and counted with its reason. A run exceeding the run timeout
+// of cfg or running when ctx is cancelled is killed with its whole process
+// group.
+func runBenchmark(ctx context.Context, bc benchmarkCommand, cfg *config) error {
+	run := newRunRecord(bc)
+	// the data file directory of a discovered mount is created on its first
+	// run, before its free space is looked up
+	if bc.discovered {
+		if err := os.MkdirAll(bc.target, 0o755); err != nil {
+			return recordFailure(run, reasonPreflight,
+				fmt.Errorf("cannot create the data file directory on %s: %w", bc.mount.mountpoint, err))
+		}
+	}
+	bc, err := bc.resolveFileSize()
+	run.Command = bc.String()
+	if err != nil {
+		return recordFailure(run, reasonPreflight, err)
+	}
+	if err := preflight(bc, cfg); err != nil {
+		return recordFailure(run, reasonPreflight, err)
+	}
+	log.Printf("Running fio: %s", bc)
+	timeout := cfg.runTimeout(bc)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	fioCommand := exec.CommandContext(ctx, bc.args[0], bc.args[1:]...)
+	// fio forks a process for every job, they are killed together
+	fioCommand.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	fioCommand.Cancel = func() error {
+		return syscall.Kill(-fioCommand.Process.Pid, syscall.SIGKILL)
+	}
+	fioStdout, err := fioCommand.StdoutPipe()
+	if err != nil {
+		return recordFailure(run, reasonStart, fmt.Errorf("creating StdoutPipe: %w", err))
+	}
+	var fioStderr bytes.Buffer
+	fioCommand.Stderr = &fioStderr
+	if err := fioCommand.Start(); err != nil {
+		return recordFailure(run, reasonStart, fmt.Errorf("starting fio: %w", err))
+	}
 
-				ioDepth8, err := strconv.ParseFloat(strings.Trim(parts[154], "%"), 64)
-				if err != nil {
-					log.Printf("Error parsing ioDepth8 (parts[154]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioIODepth8.WithLabelValues(*benchmark).Set(ioDepth8)
-				}
+	var results []*terseparser.Result
+	done := make(chan error, 1)
+	go func() {
+		if cfg.OutputFormat != "terse" {
+			results = readJSON(fioStdout, bc.series(), cfg.PerJob, run.Start)
+		} else {
+			results = readTerse(fioStdout, bc.series(), cfg.PerJob)
+		}
+		done <- fioCommand.Wait()
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// a shutdown gives up before killWait, the data files are removed
+		// before waiting for the killed fio
+		if !cfg.KeepDataFiles {
+			removeFiles(bc)
+		}
+		select {
+		case err = <-done:
+		case <-time.After(killWait):
+			// stop reading the output of the hung process, its stderr is
+			// still being written and cannot be recorded
+			fioStdout.Close()
+			log.Printf("Fio for benchmark %s did not exit %s after being killed, leaving it behind\n", bc.benchmark, killWait)
+			return killed(ctx, run, timeout)
+		}
+	}
+	run.setStderr(fioStderr.Bytes())
+	if err != nil && ctx.Err() != nil {
+		return killed(ctx, run, timeout)
+	}
+	run.setErrors(results)
+	if err != nil {
+		for _, m := range strings.Split(run.Stderr, "\n") {
+			if len(m) > 0 {
+				log.Println(m)
+			}
+		}
+		return recordFailure(run, reasonExit, fmt.Errorf("fio command error: %w", err))
+	}
+	if len(results) == 0 {
+		return recordFailure(run, reasonOutput, errors.New("no results in fio output"))
+	}
+	run.End = time.Now()
+	recordRun(run)
+	if run.Errors > 0 {
+		log.Printf("Fio reported %d errors, first error: %s\n", run.Errors, run.FirstErrorDescription)
+	}
+	log.Printf("Benchmark %s complete\n", bc.benchmark)
+	return nil
+}
 
-				ioDepth16, err := strconv.ParseFloat(strings.Trim(parts[155], "%"), 64)
-				if err != nil {
-					log.Printf("Error: parsing ioDepth16 (parts[155]) %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioIODepth16.WithLabelValues(*benchmark).Set(ioDepth16)
-				}
+// killed records a run killed after the run timeout, a run killed by a
+// shutdown is not a failure of the benchmark
+func killed(ctx context.Context, run *runRecord, timeout time.Duration) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		fioBenchmarkTimeouts.WithLabelValues(run.series().runValues()...).Inc()
+		return recordFailure(run, reasonTimeout, fmt.Errorf("fio killed after run timeout of %s", timeout))
+	}
+	log.Printf("Benchmark %s stopped by shutdown\n", run.Benchmark)
+	return errShutdown
+}
 
-				ioDepth32, err := strconv.ParseFloat(strings.Trim(parts[156], "%"), 64)
-				if err != nil {
-					log.Printf("Error parsing ioDepth32 (parts[156]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioIODepth32.WithLabelValues(*benchmark).Set(ioDepth32)
-				}
+// jobSeries returns the series the stats of the i-th job of a fio report
+// are exported as, all jobs share the series of the benchmark run s unless
+// perJob is set
+func jobSeries(s series, perJob bool, i int, r *terseparser.Result) series {
+	if perJob {
+		s.job, s.jobname = strconv.Itoa(i), r.JobName
+	}
+	return s
+}
 
-				ioDepth64, err := strconv.ParseFloat(strings.Trim(parts[157], "%"), 64)
-				if err != nil {
-					log.Printf("Error parsing ioDepth64 (parts[157]): %s\n", err)
-					fioBenchmarkSuccess.WithLabelValues(*benchmark).Set(0)
-				} else {
-					fioIODepth64.WithLabelValues(*benchmark).Set(ioDepth64)
-				}
-				// END PARSE
-			}
-			if err := fioCommand.Wait(); err != nil {
-				log.Printf("Fio command error: %s\n", err)
-				for _, m := range strings.Split(string(fioStderrBytes), "\n") {
-					if len(m) > 0 {
-						log.Println(m)
-					}
-				}
-				os.Exit(1)
-			}
-			log.Println("Benchmark complete")
-			if *runOnce {
-				log.Printf("Waiting for runOnceWait of %s to expire", runOnceWait)
-				time.Sleep(*runOnceWait)
-				os.Exit(0)
-			}
+// readTerse exports the stats of every terse v5 line fio prints and returns
+// the results of the last report, every line is a report of its own unless
+// perJob is set
+func readTerse(r io.Reader, run series, perJob bool) []*terseparser.Result {
+	var results []*terseparser.Result
+	scanner := bufio.NewScanner(r)
+	// fio terse output format provides all stats on a single line
+	scanner.Split(bufio.ScanLines)
+	for scanner.Scan() {
+		s := scanner.Text()
+		result, err := terseparser.Parse(s)
+		if errors.Is(err, terseparser.ErrSignature) {
+			log.Printf("Line does not have the fio terse v5 signature, skipping: %.6s\n", s)
+			continue
 		}
-	}()
-
-	http.Handle("/metrics", promhttp.HandlerFor(
-		promRegistry,
-		promhttp.HandlerOpts{},
-	))
+		log.Printf("Fio update: %s\n", s)
+		if err != nil {
+			log.Printf("Error parsing fio output: %s\n", err)
+			fioBenchmarkSuccess.WithLabelValues(run.runValues()...).Set(0)
+			continue
+		}
+		fioBenchmarkSuccess.WithLabelValues(run.runValues()...).Set(1)
+		if !perJob {
+			results = results[:0]
+		}
+		setMetrics(jobSeries(run, perJob, len(results), result), result)
+		results = append(results, result)
+	}
+	return results
+}
 
-	log.Printf("Listening on :%s\n", *port)
-	log.Fatal(http.ListenAndServe(":"+*port, nil))
+// readJSON exports the stats of every JSON document fio prints and returns
+// the results of the last document
+func readJSON(r io.Reader, run series, perJob bool, start time.Time) []*terseparser.Result {
+	var last []*terseparser.Result
+	dec := jsonparser.NewDecoder(r)
+	for {
+		output, err := dec.Decode()
+		if err == io.EOF {
+			return last
+		}
+		if err != nil {
+			log.Printf("Error parsing fio output: %s\n", err)
+			fioBenchmarkSuccess.WithLabelValues(run.runValues()...).Set(0)
+			// the decoder cannot resync, drain stdout so fio does not block
+			io.Copy(io.Discard, r)
+			return last
+		}
+		results, err := output.Results()
+		if err != nil {
+			log.Printf("Error parsing fio output: %s\n", err)
+			fioBenchmarkSuccess.WithLabelValues(run.runValues()...).Set(0)
+			continue
+		}
+		log.Printf("Fio update: %d job(s)\n", len(results))
+		fioBenchmarkSuccess.WithLabelValues(run.runValues()...).Set(1)
+		for i, result := range results {
+			s := jobSeries(run, perJob, i, result)
+			setMetrics(s, result)
+			setLatencyHistograms(s, start, result)
+		}
+		last = results
+	}
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReadTersePerJob(t *testing.T) {
+	line, err := os.ReadFile(filepath.Join("terseparser", "testdata", "latency.terse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fio prints one line per job without --group_reporting
+	output := strings.Repeat(string(line), 2)
+
+	results := readTerse(strings.NewReader(output), series{benchmark: "perjob", target: "/tmp"}, false)
+	if len(results) != 1 {
+		t.Errorf("group mode: got %d results, want 1", len(results))
+	}
+
+	results = readTerse(strings.NewReader(output), series{benchmark: "perjob", target: "/tmp"}, true)
+	if len(results) != 2 {
+		t.Fatalf("perJob: got %d results, want 2", len(results))
+	}
+	for _, job := range []string{"0", "1"} {
+		g, err := fioReadBW.GetMetricWithLabelValues(series{benchmark: "perjob", target: "/tmp", job: job, jobname: "latency"}.values()...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := testutil.ToFloat64(g); v != 47144 {
+			t.Errorf("job %s: got read bw %v, want 47144", job, v)
+		}
+	}
+}
+
+func TestRunBenchmarkFailures(t *testing.T) {
+	tests := []struct {
+		benchmark string
+		args      []string
+		reason    string
+	}{
+		{"fail-start", []string{filepath.Join(t.TempDir(), "fio")}, reasonStart},
+		{"fail-exit", []string{"sh", "-c", "echo 'fio: no such file' >&2; exit 1"}, reasonExit},
+		{"fail-output", []string{"sh", "-c", "echo 'fio: nothing to do'"}, reasonOutput},
+	}
+	for _, tt := range tests {
+		bc := benchmarkCommand{benchmark: tt.benchmark, args: tt.args}
+		if err := runBenchmark(context.Background(), bc, &config{OutputFormat: "terse"}); err == nil {
+			t.Errorf("%s: expected error", tt.benchmark)
+			continue
+		}
+		if v := testutil.ToFloat64(fioBenchmarkFailures.WithLabelValues(series{benchmark: tt.benchmark}.runValues(tt.reason)...)); v != 1 {
+			t.Errorf("%s: got %v failures with reason %s, want 1", tt.benchmark, v, tt.reason)
+		}
+		if v := testutil.ToFloat64(fioBenchmarkSuccess.WithLabelValues(series{benchmark: tt.benchmark}.runValues()...)); v != 0 {
+			t.Errorf("%s: got success %v, want 0", tt.benchmark, v)
+		}
+		runsMu.Lock()
+		run := lastRuns[series{benchmark: tt.benchmark}]
+		runsMu.Unlock()
+		if run == nil || run.Reason != tt.reason || run.Error == "" {
+			t.Errorf("%s: got run record %+v, want reason %s", tt.benchmark, run, tt.reason)
+		}
+	}
+
+	runsMu.Lock()
+	stderr := lastRuns[series{benchmark: "fail-exit"}].Stderr
+	runsMu.Unlock()
+	if !strings.Contains(stderr, "fio: no such file") {
+		t.Errorf("fail-exit: got stderr %q", stderr)
+	}
+}
+
+func TestRunBenchmarkTimeout(t *testing.T) {
+	defer func(d time.Duration) { killWait = d }(killWait)
+	killWait = 10 * time.Second
+
+	// the background sleep keeps stdout open unless the process group is
+	// killed
+	bc := benchmarkCommand{benchmark: "timeout", args: []string{"sh", "-c", "sleep 60 & wait"}}
+	start := time.Now()
+	if err := runBenchmark(context.Background(), bc, &config{OutputFormat: "terse", RunTimeout: 100 * time.Millisecond}); err == nil {
+		t.Fatal("expected error")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("run took %s, the process group was not killed", d)
+	}
+	if v := testutil.ToFloat64(fioBenchmarkTimeouts.WithLabelValues(series{benchmark: "timeout"}.runValues()...)); v != 1 {
+		t.Errorf("got %v timeouts, want 1", v)
+	}
+	if v := testutil.ToFloat64(fioBenchmarkFailures.WithLabelValues(series{benchmark: "timeout"}.runValues(reasonTimeout)...)); v != 1 {
+		t.Errorf("got %v failures with reason %s, want 1", v, reasonTimeout)
+	}
+}
+
+func TestRunBenchmarkShutdownRemovesFiles(t *testing.T) {
+	defer func(d time.Duration) { killWait = d }(killWait)
+	killWait = 10 * time.Second
+
+	dir := t.TempDir()
+	data := filepath.Join(dir, "hung.0.0")
+	// the sleep in a session of its own survives the kill and keeps stdout
+	// open, like a fio stuck in uninterruptible IO
+	bc := benchmarkCommand{
+		benchmark: "hung",
+		args:      []string{"sh", "-c", "echo data > " + data + "; setsid sleep 3 & wait"},
+		files:     []string{filepath.Join(dir, "hung.[0-9]*.[0-9]*")},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		runBenchmark(ctx, bc, &config{OutputFormat: "terse"})
+		close(stopped)
+	}()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(data); err == nil {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("fio command did not start")
+		}
+	}
+	cancel()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(data); os.IsNotExist(err) {
+			break
+		}
+		if time.Since(start) > 2*time.Second {
+			t.Fatal("data file not removed while waiting for the killed command")
+		}
+	}
+	<-stopped
+}
@@ -0,0 +1,1037 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/fritchie/fio_benchmark_exporter/terseparser"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// labels are used by the metrics of a fio job, target is the directory or
+// device the benchmark ran against, mountpoint, fstype and device describe
+// the mount or block device of the target. job and jobname are empty unless
+// the exporter runs with perJob.
+var labels = []string{"benchmark", "target", "mountpoint", "fstype", "device", "job", "jobname"}
+
+// benchmarkLabels are used by metrics of a benchmark run as a whole
+var benchmarkLabels = []string{"benchmark", "target", "mountpoint", "fstype", "device"}
+
+// ioDepthLabels are used by the IO depth distributions, depth is the bucket
+// fio reports the percentage of IOs for
+var ioDepthLabels = []string{"benchmark", "target", "mountpoint", "fstype", "device", "job", "jobname", "depth"}
+
+// latencyDistributionLabels are used by the latency distribution, le is the
+// upper bound of a bucket in unit
+var latencyDistributionLabels = []string{"benchmark", "target", "mountpoint", "fstype", "device", "job", "jobname", "unit", "le"}
+
+// failureLabels are used by the failure counter, reason is why a run
+// failed
+var failureLabels = []string{"benchmark", "target", "mountpoint", "fstype", "device", "reason"}
+
+// directoryLabels are used by metrics of the directories a benchmark lays
+// out its data files in
+var directoryLabels = []string{"benchmark", "target", "mountpoint", "fstype", "device", "directory"}
+
+// series holds the label values of the metrics of one fio job, job is the
+// position of the job in the fio output
+type series struct {
+	benchmark  string
+	target     string
+	mountpoint string
+	fstype     string
+	device     string
+	job        string
+	jobname    string
+}
+
+// values returns the label values of s followed by extra
+func (s series) values(extra ...string) []string {
+	return append([]string{s.benchmark, s.target, s.mountpoint, s.fstype, s.device, s.job, s.jobname}, extra...)
+}
+
+// runValues returns the label values of the benchmark run of s followed
+// by extra
+func (s series) runValues(extra ...string) []string {
+	return append([]string{s.benchmark, s.target, s.mountpoint, s.fstype, s.device}, extra...)
+}
+
+// diskLabels are used by the disk utilization metrics, fio reports one set
+// of disk stats per disk involved in the benchmark
+var diskLabels = []string{"benchmark", "target", "mountpoint", "fstype", "device", "disk"}
+
+// diskDirectionLabels split disk stats fio reports per data direction
+var diskDirectionLabels = []string{"benchmark", "target", "mountpoint", "fstype", "device", "disk", "direction"}
+
+// targetInfoLabels are used by the block device metadata of targets,
+// device is the device label of the benchmark metrics and the other labels
+// are read from sysfs for the disk holding device
+var targetInfoLabels = []string{"device", "model", "serial", "rotational", "scheduler", "logical_block_size", "nr_requests", "fstype"}
+
+var (
+	promRegistry = prometheus.NewRegistry()
+	// START METRICS
+	fioReadBW = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_bandwidth_kbps",
+			Help: "Read bandwidth (KiB/s)",
+		},
+		labels,
+	)
+	fioReadIOPS = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_iops",
+			Help: "Read IOPS",
+		},
+		labels,
+	)
+	fioReadLat90 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_lat_pct90",
+			Help: "Read total latency 90th percentile (usec)",
+		},
+		labels,
+	)
+	fioReadLat95 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_lat_pct95",
+			Help: "Read total latency 95th percentile (usec)",
+		},
+		labels,
+	)
+	fioReadLat99 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_lat_pct99",
+			Help: "Read total latency 99th percentile (usec)",
+		},
+		labels,
+	)
+	fioReadLatMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_lat_min",
+			Help: "Read total latency minimum (usec)",
+		},
+		labels,
+	)
+	fioReadLatMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_lat_max",
+			Help: "Read total latency maximum (usec)",
+		},
+		labels,
+	)
+	fioReadLatMean = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_lat_mean",
+			Help: "Read total latency mean (usec)",
+		},
+		labels,
+	)
+	fioReadBWMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_bw_min_kb",
+			Help: "Read bandwidth minimum (KiB/s)",
+		},
+		labels,
+	)
+	fioReadBWMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_bw_max_kb",
+			Help: "Read bandwidth maximum (KiB/s)",
+		},
+		labels,
+	)
+	fioReadBWMean = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_bw_mean_kb",
+			Help: "Read bandwidth mean (KiB/s)",
+		},
+		labels,
+	)
+	fioReadIOPSMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_iops_min",
+			Help: "Read IOPS minimum",
+		},
+		labels,
+	)
+	fioReadIOPSMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_iops_max",
+			Help: "Read IOPS maximum",
+		},
+		labels,
+	)
+	fioReadIOPSMean = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_iops_mean",
+			Help: "Read IOPS mean",
+		},
+		labels,
+	)
+	fioWriteBW = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_bandwidth_kbps",
+			Help: "Write bandwidth (KiB/s)",
+		},
+		labels,
+	)
+	fioWriteIOPS = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_iops",
+			Help: "Write IOPS",
+		},
+		labels,
+	)
+	fioWriteLat90 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_lat_pct90",
+			Help: "Write total latency 90th percentile (usec)",
+		},
+		labels,
+	)
+	fioWriteLat95 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_lat_pct95",
+			Help: "Write total latency 95th percentile (usec)",
+		},
+		labels,
+	)
+	fioWriteLat99 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_lat_pct99",
+			Help: "Write total latency 99th percentile (usec)",
+		},
+		labels,
+	)
+	fioWriteLatMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_lat_min",
+			Help: "Write total latency minimum (usec)",
+		},
+		labels,
+	)
+	fioWriteLatMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_lat_max",
+			Help: "Write total latency maximum (usec)",
+		},
+		labels,
+	)
+	fioWriteLatMean = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_lat_mean",
+			Help: "Read total latency mean (usec)",
+		},
+		labels,
+	)
+	fioWriteBWMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_bw_min_kb",
+			Help: "Write bandwidth minimum (KiB/s)",
+		},
+		labels,
+	)
+	fioWriteBWMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_bw_max_kb",
+			Help: "Write bandwidth maximum (KiB/s)",
+		},
+		labels,
+	)
+	fioWriteBWMean = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_bw_mean_kb",
+			Help: "Write bandwidth mean (KiB/s)",
+		},
+		labels,
+	)
+	fioWriteIOPSMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_iops_min",
+			Help: "Write IOPS minimum",
+		},
+		labels,
+	)
+	fioWriteIOPSMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_iops_max",
+			Help: "Write IOPS maximum",
+		},
+		labels,
+	)
+	fioWriteIOPSMean = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_iops_mean",
+			Help: "Write IOPS mean",
+		},
+		labels,
+	)
+	fioTrimBW = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_bandwidth_kbps",
+			Help: "Trim bandwidth (KiB/s)",
+		},
+		labels,
+	)
+	fioTrimIOPS = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_iops",
+			Help: "Trim IOPS",
+		},
+		labels,
+	)
+	fioTrimLat90 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_lat_pct90",
+			Help: "Trim total latency 90th percentile (usec)",
+		},
+		labels,
+	)
+	fioTrimLat95 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_lat_pct95",
+			Help: "Trim total latency 95th percentile (usec)",
+		},
+		labels,
+	)
+	fioTrimLat99 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_lat_pct99",
+			Help: "Trim total latency 99th percentile (usec)",
+		},
+		labels,
+	)
+	fioTrimLatMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_lat_min",
+			Help: "Trim total latency minimum (usec)",
+		},
+		labels,
+	)
+	fioTrimLatMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_lat_max",
+			Help: "Trim total latency maximum (usec)",
+		},
+		labels,
+	)
+	fioTrimLatMean = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_lat_mean",
+			Help: "Trim total latency mean (usec)",
+		},
+		labels,
+	)
+	fioTrimBWMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_bw_min_kb",
+			Help: "Trim bandwidth minimum (KiB/s)",
+		},
+		labels,
+	)
+	fioTrimBWMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_bw_max_kb",
+			Help: "Trim bandwidth maximum (KiB/s)",
+		},
+		labels,
+	)
+	fioTrimBWMean = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_bw_mean_kb",
+			Help: "Trim bandwidth mean (KiB/s)",
+		},
+		labels,
+	)
+	fioTrimIOPSMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_iops_min",
+			Help: "Trim IOPS minimum",
+		},
+		labels,
+	)
+	fioTrimIOPSMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_iops_max",
+			Help: "Trim IOPS maximum",
+		},
+		labels,
+	)
+	fioTrimIOPSMean = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_iops_mean",
+			Help: "Trim IOPS mean",
+		},
+		labels,
+	)
+	fioReadSlatMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_slat_min",
+			Help: "Read submission latency minimum (usec)",
+		},
+		labels,
+	)
+	fioReadSlatMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_slat_max",
+			Help: "Read submission latency maximum (usec)",
+		},
+		labels,
+	)
+	fioReadSlatMean = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_slat_mean",
+			Help: "Read submission latency mean (usec)",
+		},
+		labels,
+	)
+	fioReadSlatStddev = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_slat_stddev",
+			Help: "Read submission latency standard deviation (usec)",
+		},
+		labels,
+	)
+	fioReadClatMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_clat_min",
+			Help: "Read completion latency minimum (usec)",
+		},
+		labels,
+	)
+	fioReadClatMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_clat_max",
+			Help: "Read completion latency maximum (usec)",
+		},
+		labels,
+	)
+	fioReadClatMean = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_clat_mean",
+			Help: "Read completion latency mean (usec)",
+		},
+		labels,
+	)
+	fioReadClatStddev = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_clat_stddev",
+			Help: "Read completion latency standard deviation (usec)",
+		},
+		labels,
+	)
+	fioReadClat90 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_clat_pct90",
+			Help: "Read completion latency 90th percentile (usec), json outputFormat only",
+		},
+		labels,
+	)
+	fioReadClat95 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_clat_pct95",
+			Help: "Read completion latency 95th percentile (usec), json outputFormat only",
+		},
+		labels,
+	)
+	fioReadClat99 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_read_clat_pct99",
+			Help: "Read completion latency 99th percentile (usec), json outputFormat only",
+		},
+		labels,
+	)
+	fioWriteSlatMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_slat_min",
+			Help: "Write submission latency minimum (usec)",
+		},
+		labels,
+	)
+	fioWriteSlatMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_slat_max",
+			Help: "Write submission latency maximum (usec)",
+		},
+		labels,
+	)
+	fioWriteSlatMean = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_slat_mean",
+			Help: "Write submission latency mean (usec)",
+		},
+		labels,
+	)
+	fioWriteSlatStddev = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_slat_stddev",
+			Help: "Write submission latency standard deviation (usec)",
+		},
+		labels,
+	)
+	fioWriteClatMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_clat_min",
+			Help: "Write completion latency minimum (usec)",
+		},
+		labels,
+	)
+	fioWriteClatMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_clat_max",
+			Help: "Write completion latency maximum (usec)",
+		},
+		labels,
+	)
+	fioWriteClatMean = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_clat_mean",
+			Help: "Write completion latency mean (usec)",
+		},
+		labels,
+	)
+	fioWriteClatStddev = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_clat_stddev",
+			Help: "Write completion latency standard deviation (usec)",
+		},
+		labels,
+	)
+	fioWriteClat90 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_clat_pct90",
+			Help: "Write completion latency 90th percentile (usec), json outputFormat only",
+		},
+		labels,
+	)
+	fioWriteClat95 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_clat_pct95",
+			Help: "Write completion latency 95th percentile (usec), json outputFormat only",
+		},
+		labels,
+	)
+	fioWriteClat99 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_write_clat_pct99",
+			Help: "Write completion latency 99th percentile (usec), json outputFormat only",
+		},
+		labels,
+	)
+	fioTrimSlatMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_slat_min",
+			Help: "Trim submission latency minimum (usec)",
+		},
+		labels,
+	)
+	fioTrimSlatMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_slat_max",
+			Help: "Trim submission latency maximum (usec)",
+		},
+		labels,
+	)
+	fioTrimSlatMean = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_slat_mean",
+			Help: "Trim submission latency mean (usec)",
+		},
+		labels,
+	)
+	fioTrimSlatStddev = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_slat_stddev",
+			Help: "Trim submission latency standard deviation (usec)",
+		},
+		labels,
+	)
+	fioTrimClatMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_clat_min",
+			Help: "Trim completion latency minimum (usec)",
+		},
+		labels,
+	)
+	fioTrimClatMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_clat_max",
+			Help: "Trim completion latency maximum (usec)",
+		},
+		labels,
+	)
+	fioTrimClatMean = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_clat_mean",
+			Help: "Trim completion latency mean (usec)",
+		},
+		labels,
+	)
+	fioTrimClatStddev = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_clat_stddev",
+			Help: "Trim completion latency standard deviation (usec)",
+		},
+		labels,
+	)
+	fioTrimClat90 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_clat_pct90",
+			Help: "Trim completion latency 90th percentile (usec), json outputFormat only",
+		},
+		labels,
+	)
+	fioTrimClat95 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_clat_pct95",
+			Help: "Trim completion latency 95th percentile (usec), json outputFormat only",
+		},
+		labels,
+	)
+	fioTrimClat99 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_trim_clat_pct99",
+			Help: "Trim completion latency 99th percentile (usec), json outputFormat only",
+		},
+		labels,
+	)
+	fioCpuUser = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_cpu_user",
+			Help: "User CPU utilization (%)",
+		},
+		labels,
+	)
+	fioCpuSys = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_cpu_sys",
+			Help: "System CPU utilization (%)",
+		},
+		labels,
+	)
+	fioCpuContextSwitches = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_cpu_context_switches",
+			Help: "Context switches during benchmark",
+		},
+		labels,
+	)
+	fioMajorPageFaults = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_major_page_faults",
+			Help: "Major page faults during benchmark",
+		},
+		labels,
+	)
+	fioMinorPageFaults = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_minor_page_faults",
+			Help: "Minor page faults during benchmark",
+		},
+		labels,
+	)
+	fioIODepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_iodepth_percent",
+			Help: "IOs issued at queue depth, the 1 bucket is <=1 (%)",
+		},
+		ioDepthLabels,
+	)
+	fioIODepthSubmit = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_iodepth_submit_percent",
+			Help: "IOs submitted per submit call, json outputFormat only (%)",
+		},
+		ioDepthLabels,
+	)
+	fioIODepthComplete = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_iodepth_complete_percent",
+			Help: "IOs completed per completion call, json outputFormat only (%)",
+		},
+		ioDepthLabels,
+	)
+	fioLatencyDistribution = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_latency_distribution_percent",
+			Help: "IOs completed within the latency bucket, buckets are not cumulative (%)",
+		},
+		latencyDistributionLabels,
+	)
+	fioDiskUtil = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_disk_util_percent",
+			Help: "Disk utilization during benchmark (%)",
+		},
+		diskLabels,
+	)
+	fioDiskIOs = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_disk_ios_total",
+			Help: "IOs completed by the disk during benchmark",
+		},
+		diskDirectionLabels,
+	)
+	fioDiskMerges = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_disk_merges_total",
+			Help: "IOs merged by the disk IO scheduler during benchmark",
+		},
+		diskDirectionLabels,
+	)
+	fioDiskInQueue = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_disk_in_queue_ticks",
+			Help: "Time spent in the disk queue during benchmark (msec)",
+		},
+		diskLabels,
+	)
+	fioReadLatency = newLatencyHistogram(
+		"fio_read_latency_seconds",
+		"Read total latency histogram (seconds), json+ outputFormat only",
+	)
+	fioWriteLatency = newLatencyHistogram(
+		"fio_write_latency_seconds",
+		"Write total latency histogram (seconds), json+ outputFormat only",
+	)
+	fioTrimLatency = newLatencyHistogram(
+		"fio_trim_latency_seconds",
+		"Trim total latency histogram (seconds), json+ outputFormat only",
+	)
+	fioErrors = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_errors_total",
+			Help: "IO errors during benchmark, fio only counts errors with --continue_on_error",
+		},
+		labels,
+	)
+	fioFirstError = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_first_error_code",
+			Help: "Error number (errno) of the first IO error during benchmark, 0 if none",
+		},
+		labels,
+	)
+	fioBenchmarkSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_benchmark_success",
+			Help: "1 if last benchmark was successful, 0 otherwise",
+		},
+		benchmarkLabels,
+	)
+	fioBenchmarkFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "fio_benchmark_failures_total",
+			Help: "Failed benchmark runs by reason",
+		},
+		failureLabels,
+	)
+	fioBenchmarkTimeouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "fio_benchmark_timeouts_total",
+			Help: "Benchmark runs killed after exceeding the run timeout",
+		},
+		benchmarkLabels,
+	)
+	fioDataFilesRemoved = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "fio_data_files_removed_bytes_total",
+			Help: "Bytes reclaimed by removing fio data files after runs and on startup",
+		},
+		benchmarkLabels,
+	)
+	fioTargetFree = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_target_free_bytes",
+			Help: "Free bytes of the filesystem of a benchmark directory before the last run",
+		},
+		directoryLabels,
+	)
+	fioBenchmarkFileSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_benchmark_file_size_bytes",
+			Help: "Size of the data file of every fio job of the last run",
+		},
+		benchmarkLabels,
+	)
+	fioTargetInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "fio_target_info",
+			Help: "Block device and filesystem of benchmark targets, joins the device label of the benchmark metrics, always 1",
+		},
+		targetInfoLabels,
+	)
+	// END METRICS
+)
+
+// registerMetrics registers all metrics with reg
+func registerMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		fioReadBW,
+		fioReadIOPS,
+		fioReadLat90,
+		fioReadLat95,
+		fioReadLat99,
+		fioReadLatMin,
+		fioReadLatMax,
+		fioReadLatMean,
+		fioReadBWMin,
+		fioReadBWMax,
+		fioReadBWMean,
+		fioReadIOPSMin,
+		fioReadIOPSMax,
+		fioReadIOPSMean,
+		fioWriteBW,
+		fioWriteIOPS,
+		fioWriteLat90,
+		fioWriteLat95,
+		fioWriteLat99,
+		fioWriteLatMin,
+		fioWriteLatMax,
+		fioWriteLatMean,
+		fioWriteBWMin,
+		fioWriteBWMax,
+		fioWriteBWMean,
+		fioWriteIOPSMin,
+		fioWriteIOPSMax,
+		fioWriteIOPSMean,
+		fioTrimBW,
+		fioTrimIOPS,
+		fioTrimLat90,
+		fioTrimLat95,
+		fioTrimLat99,
+		fioTrimLatMin,
+		fioTrimLatMax,
+		fioTrimLatMean,
+		fioTrimBWMin,
+		fioTrimBWMax,
+		fioTrimBWMean,
+		fioTrimIOPSMin,
+		fioTrimIOPSMax,
+		fioTrimIOPSMean,
+		fioReadSlatMin,
+		fioReadSlatMax,
+		fioReadSlatMean,
+		fioReadSlatStddev,
+		fioReadClatMin,
+		fioReadClatMax,
+		fioReadClatMean,
+		fioReadClatStddev,
+		fioReadClat90,
+		fioReadClat95,
+		fioReadClat99,
+		fioWriteSlatMin,
+		fioWriteSlatMax,
+		fioWriteSlatMean,
+		fioWriteSlatStddev,
+		fioWriteClatMin,
+		fioWriteClatMax,
+		fioWriteClatMean,
+		fioWriteClatStddev,
+		fioWriteClat90,
+		fioWriteClat95,
+		fioWriteClat99,
+		fioTrimSlatMin,
+		fioTrimSlatMax,
+		fioTrimSlatMean,
+		fioTrimSlatStddev,
+		fioTrimClatMin,
+		fioTrimClatMax,
+		fioTrimClatMean,
+		fioTrimClatStddev,
+		fioTrimClat90,
+		fioTrimClat95,
+		fioTrimClat99,
+		fioCpuUser,
+		fioCpuSys,
+		fioCpuContextSwitches,
+		fioMajorPageFaults,
+		fioMinorPageFaults,
+		fioIODepth,
+		fioIODepthSubmit,
+		fioIODepthComplete,
+		fioLatencyDistribution,
+		fioDiskUtil,
+		fioDiskIOs,
+		fioDiskMerges,
+		fioDiskInQueue,
+		fioReadLatency,
+		fioWriteLatency,
+		fioTrimLatency,
+		fioErrors,
+		fioFirstError,
+		fioBenchmarkSuccess,
+		fioBenchmarkFailures,
+		fioBenchmarkTimeouts,
+		fioDataFilesRemoved,
+		fioTargetFree,
+		fioBenchmarkFileSize,
+		fioTargetInfo,
+	)
+}
+
+// setMetrics updates all gauges of a job from a parsed fio result
+func setMetrics(s series, r *terseparser.Result) {
+	fioReadBW.WithLabelValues(s.values()...).Set(r.Read.Bandwidth)
+	fioReadIOPS.WithLabelValues(s.values()...).Set(r.Read.IOPS)
+	setPercentile(fioReadLat90, s, &r.Read, 90)
+	setPercentile(fioReadLat95, s, &r.Read, 95)
+	setPercentile(fioReadLat99, s, &r.Read, 99)
+	fioReadLatMin.WithLabelValues(s.values()...).Set(r.Read.Lat.Min)
+	fioReadLatMax.WithLabelValues(s.values()...).Set(r.Read.Lat.Max)
+	fioReadLatMean.WithLabelValues(s.values()...).Set(r.Read.Lat.Mean)
+	fioReadBWMin.WithLabelValues(s.values()...).Set(r.Read.BandwidthStats.Min)
+	fioReadBWMax.WithLabelValues(s.values()...).Set(r.Read.BandwidthStats.Max)
+	fioReadBWMean.WithLabelValues(s.values()...).Set(r.Read.BandwidthStats.Mean)
+	fioReadIOPSMin.WithLabelValues(s.values()...).Set(r.Read.IOPSStats.Min)
+	fioReadIOPSMax.WithLabelValues(s.values()...).Set(r.Read.IOPSStats.Max)
+	fioReadIOPSMean.WithLabelValues(s.values()...).Set(r.Read.IOPSStats.Mean)
+
+	fioWriteBW.WithLabelValues(s.values()...).Set(r.Write.Bandwidth)
+	fioWriteIOPS.WithLabelValues(s.values()...).Set(r.Write.IOPS)
+	setPercentile(fioWriteLat90, s, &r.Write, 90)
+	setPercentile(fioWriteLat95, s, &r.Write, 95)
+	setPercentile(fioWriteLat99, s, &r.Write, 99)
+	fioWriteLatMin.WithLabelValues(s.values()...).Set(r.Write.Lat.Min)
+	fioWriteLatMax.WithLabelValues(s.values()...).Set(r.Write.Lat.Max)
+	fioWriteLatMean.WithLabelValues(s.values()...).Set(r.Write.Lat.Mean)
+	fioWriteBWMin.WithLabelValues(s.values()...).Set(r.Write.BandwidthStats.Min)
+	fioWriteBWMax.WithLabelValues(s.values()...).Set(r.Write.BandwidthStats.Max)
+	fioWriteBWMean.WithLabelValues(s.values()...).Set(r.Write.BandwidthStats.Mean)
+	fioWriteIOPSMin.WithLabelValues(s.values()...).Set(r.Write.IOPSStats.Min)
+	fioWriteIOPSMax.WithLabelValues(s.values()...).Set(r.Write.IOPSStats.Max)
+	fioWriteIOPSMean.WithLabelValues(s.values()...).Set(r.Write.IOPSStats.Mean)
+
+	fioTrimBW.WithLabelValues(s.values()...).Set(r.Trim.Bandwidth)
+	fioTrimIOPS.WithLabelValues(s.values()...).Set(r.Trim.IOPS)
+	setPercentile(fioTrimLat90, s, &r.Trim, 90)
+	setPercentile(fioTrimLat95, s, &r.Trim, 95)
+	setPercentile(fioTrimLat99, s, &r.Trim, 99)
+	fioTrimLatMin.WithLabelValues(s.values()...).Set(r.Trim.Lat.Min)
+	fioTrimLatMax.WithLabelValues(s.values()...).Set(r.Trim.Lat.Max)
+	fioTrimLatMean.WithLabelValues(s.values()...).Set(r.Trim.Lat.Mean)
+	fioTrimBWMin.WithLabelValues(s.values()...).Set(r.Trim.BandwidthStats.Min)
+	fioTrimBWMax.WithLabelValues(s.values()...).Set(r.Trim.BandwidthStats.Max)
+	fioTrimBWMean.WithLabelValues(s.values()...).Set(r.Trim.BandwidthStats.Mean)
+	fioTrimIOPSMin.WithLabelValues(s.values()...).Set(r.Trim.IOPSStats.Min)
+	fioTrimIOPSMax.WithLabelValues(s.values()...).Set(r.Trim.IOPSStats.Max)
+	fioTrimIOPSMean.WithLabelValues(s.values()...).Set(r.Trim.IOPSStats.Mean)
+
+	fioReadSlatMin.WithLabelValues(s.values()...).Set(r.Read.Slat.Min)
+	fioReadSlatMax.WithLabelValues(s.values()...).Set(r.Read.Slat.Max)
+	fioReadSlatMean.WithLabelValues(s.values()...).Set(r.Read.Slat.Mean)
+	fioReadSlatStddev.WithLabelValues(s.values()...).Set(r.Read.Slat.Stddev)
+	fioReadClatMin.WithLabelValues(s.values()...).Set(r.Read.Clat.Min)
+	fioReadClatMax.WithLabelValues(s.values()...).Set(r.Read.Clat.Max)
+	fioReadClatMean.WithLabelValues(s.values()...).Set(r.Read.Clat.Mean)
+	fioReadClatStddev.WithLabelValues(s.values()...).Set(r.Read.Clat.Stddev)
+	setClatPercentile(fioReadClat90, s, &r.Read, 90)
+	setClatPercentile(fioReadClat95, s, &r.Read, 95)
+	setClatPercentile(fioReadClat99, s, &r.Read, 99)
+
+	fioWriteSlatMin.WithLabelValues(s.values()...).Set(r.Write.Slat.Min)
+	fioWriteSlatMax.WithLabelValues(s.values()...).Set(r.Write.Slat.Max)
+	fioWriteSlatMean.WithLabelValues(s.values()...).Set(r.Write.Slat.Mean)
+	fioWriteSlatStddev.WithLabelValues(s.values()...).Set(r.Write.Slat.Stddev)
+	fioWriteClatMin.WithLabelValues(s.values()...).Set(r.Write.Clat.Min)
+	fioWriteClatMax.WithLabelValues(s.values()...).Set(r.Write.Clat.Max)
+	fioWriteClatMean.WithLabelValues(s.values()...).Set(r.Write.Clat.Mean)
+	fioWriteClatStddev.WithLabelValues(s.values()...).Set(r.Write.Clat.Stddev)
+	setClatPercentile(fioWriteClat90, s, &r.Write, 90)
+	setClatPercentile(fioWriteClat95, s, &r.Write, 95)
+	setClatPercentile(fioWriteClat99, s, &r.Write, 99)
+
+	fioTrimSlatMin.WithLabelValues(s.values()...).Set(r.Trim.Slat.Min)
+	fioTrimSlatMax.WithLabelValues(s.values()...).Set(r.Trim.Slat.Max)
+	fioTrimSlatMean.WithLabelValues(s.values()...).Set(r.Trim.Slat.Mean)
+	fioTrimSlatStddev.WithLabelValues(s.values()...).Set(r.Trim.Slat.Stddev)
+	fioTrimClatMin.WithLabelValues(s.values()...).Set(r.Trim.Clat.Min)
+	fioTrimClatMax.WithLabelValues(s.values()...).Set(r.Trim.Clat.Max)
+	fioTrimClatMean.WithLabelValues(s.values()...).Set(r.Trim.Clat.Mean)
+	fioTrimClatStddev.WithLabelValues(s.values()...).Set(r.Trim.Clat.Stddev)
+	setClatPercentile(fioTrimClat90, s, &r.Trim, 90)
+	setClatPercentile(fioTrimClat95, s, &r.Trim, 95)
+	setClatPercentile(fioTrimClat99, s, &r.Trim, 99)
+
+	fioErrors.WithLabelValues(s.values()...).Set(float64(r.TotalErrors))
+	fioFirstError.WithLabelValues(s.values()...).Set(float64(r.FirstError))
+
+	fioCpuUser.WithLabelValues(s.values()...).Set(r.CPU.User)
+	fioCpuSys.WithLabelValues(s.values()...).Set(r.CPU.System)
+	fioCpuContextSwitches.WithLabelValues(s.values()...).Set(r.CPU.ContextSwitches)
+	fioMajorPageFaults.WithLabelValues(s.values()...).Set(r.CPU.MajorFaults)
+	fioMinorPageFaults.WithLabelValues(s.values()...).Set(r.CPU.MinorFaults)
+
+	setIODepth(fioIODepth, s, r.IODepth)
+	setIODepth(fioIODepthSubmit, s, r.IODepthSubmit)
+	setIODepth(fioIODepthComplete, s, r.IODepthComplete)
+
+	setLatencyDistribution(s, "us", r.LatencyUs)
+	setLatencyDistribution(s, "ms", r.LatencyMs)
+
+	// drop disks of earlier runs, the disks involved change with the
+	// benchmark directory. Disk stats are the same for every job of a run so
+	// they are only labeled with the benchmark and target
+	for _, g := range []*prometheus.GaugeVec{fioDiskUtil, fioDiskIOs, fioDiskMerges, fioDiskInQueue} {
+		g.DeletePartialMatch(prometheus.Labels{"benchmark": s.benchmark, "target": s.target})
+	}
+	for _, d := range r.Disks {
+		fioDiskUtil.WithLabelValues(s.runValues(d.Name)...).Set(d.Util)
+		fioDiskIOs.WithLabelValues(s.runValues(d.Name, "read")...).Set(d.ReadIOs)
+		fioDiskIOs.WithLabelValues(s.runValues(d.Name, "write")...).Set(d.WriteIOs)
+		fioDiskMerges.WithLabelValues(s.runValues(d.Name, "read")...).Set(d.ReadMerges)
+		fioDiskMerges.WithLabelValues(s.runValues(d.Name, "write")...).Set(d.WriteMerges)
+		fioDiskInQueue.WithLabelValues(s.runValues(d.Name)...).Set(d.InQueue)
+	}
+}
+
+// setIODepth sets the buckets of an IO depth distribution, terse output
+// does not include the submit and complete distributions
+func setIODepth(g *prometheus.GaugeVec, s series, buckets []terseparser.Bucket) {
+	for _, b := range buckets {
+		g.WithLabelValues(s.values(b.Label)...).Set(b.Percent)
+	}
+}
+
+// setLatencyDistribution sets the latency distribution buckets of one unit,
+// the open ended ">=2000" msec bucket is exported with le="+Inf"
+func setLatencyDistribution(s series, unit string, buckets []terseparser.Bucket) {
+	for _, b := range buckets {
+		le := b.Label
+		if strings.HasPrefix(le, ">=") {
+			le = "+Inf"
+		}
+		fioLatencyDistribution.WithLabelValues(s.values(unit, le)...).Set(b.Percent)
+	}
+}
+
+// setLatencyHistograms updates the latency histograms of a job, only
+// fio json+ output includes the latency bins they are built from
+func setLatencyHistograms(s series, start time.Time, r *terseparser.Result) {
+	if len(r.Read.Bins) > 0 {
+		fioReadLatency.Set(s, start, r.Read.Bins)
+	}
+	if len(r.Write.Bins) > 0 {
+		fioWriteLatency.Set(s, start, r.Write.Bins)
+	}
+	if len(r.Trim.Bins) > 0 {
+		fioTrimLatency.Set(s, start, r.Trim.Bins)
+	}
+}
+
+// setPercentile sets g to percentile p, fio only reports the percentiles
+// requested with --percentile_list so missing values are skipped
+func setPercentile(g *prometheus.GaugeVec, s series, stats *terseparser.IOStats, p float64) {
+	if v, ok := stats.Percentile(p); ok {
+		g.WithLabelValues(s.values()...).Set(v)
+	}
+}
+
+// setClatPercentile sets g to completion latency percentile p if fio
+// reported it
+func setClatPercentile(g *prometheus.GaugeVec, s series, stats *terseparser.IOStats, p float64) {
+	if v, ok := stats.ClatPercentile(p); ok {
+		g.WithLabelValues(s.values()...).Set(v)
+	}
+}
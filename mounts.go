@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// mountinfoPath is read for the mounted filesystems
+var mountinfoPath = "/proc/self/mountinfo"
+
+// discoveryDir is the subdirectory of a discovered mount holding the data
+// files, it is created on the first run
+const discoveryDir = "fio_benchmark_exporter"
+
+// mount is a mounted filesystem
+type mount struct {
+	mountpoint string
+	fstype     string
+	// device is the mount source, e.g. /dev/sdb1
+	device string
+	// majorMinor is the device number of the filesystem, e.g. 8:17
+	majorMinor string
+}
+
+// dir returns the directory the data files on the mount are laid out in
+func (m mount) dir() string {
+	return filepath.Join(m.mountpoint, discoveryDir)
+}
+
+// discoveryConfig selects the mounted filesystems predefined benchmarks
+// run against instead of the directory and targets flags
+type discoveryConfig struct {
+	// Mountpoints is a glob of the mount points to benchmark, discovery
+	// is off if empty
+	Mountpoints string `yaml:"mountpoints"`
+	// Fstypes are the filesystem types to benchmark, any if empty
+	Fstypes []string `yaml:"fstypes"`
+	// MinSize is the smallest filesystem size to benchmark, a fio size
+	MinSize string `yaml:"minSize"`
+}
+
+// enabled reports whether mounts are discovered
+func (d discoveryConfig) enabled() bool {
+	return d.Mountpoints != ""
+}
+
+// validate checks the discovery settings
+func (d discoveryConfig) validate() []error {
+	if !d.enabled() {
+		return nil
+	}
+	var errs []error
+	if _, err := filepath.Match(d.Mountpoints, ""); err != nil || !filepath.IsAbs(d.Mountpoints) {
+		errs = append(errs, fmt.Errorf("invalid discovery mountpoints %q, must be an absolute path glob like /mnt/*", d.Mountpoints))
+	}
+	if _, err := parseFioSize(d.MinSize); d.MinSize != "" && err != nil {
+		errs = append(errs, fmt.Errorf("invalid discovery minSize %q, must be a fio size like 100G", d.MinSize))
+	}
+	return errs
+}
+
+// discover returns the mounts matching the discovery settings. A mount
+// point mounted over is skipped and a filesystem mounted more than once,
+// e.g. by a bind mount, is returned once.
+func (d discoveryConfig) discover() ([]mount, error) {
+	mounts, err := readMounts()
+	if err != nil {
+		return nil, err
+	}
+	var minSize int64
+	if d.MinSize != "" {
+		// checked by validate
+		minSize, _ = parseFioSize(d.MinSize)
+	}
+	// the last mount at a mount point hides the earlier ones
+	last := make(map[string]int)
+	for i, m := range mounts {
+		last[m.mountpoint] = i
+	}
+	seen := make(map[string]bool)
+	var found []mount
+	for i, m := range mounts {
+		if last[m.mountpoint] != i || seen[m.majorMinor] {
+			continue
+		}
+		if ok, _ := filepath.Match(d.Mountpoints, m.mountpoint); !ok {
+			continue
+		}
+		if len(d.Fstypes) > 0 && !slices.Contains(d.Fstypes, m.fstype) {
+			continue
+		}
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(m.mountpoint, &st); err != nil || int64(st.Blocks)*int64(st.Bsize) < minSize {
+			continue
+		}
+		seen[m.majorMinor] = true
+		found = append(found, m)
+	}
+	return found, nil
+}
+
+// readMounts returns the mounts of mountinfoPath in mount order
+func readMounts() ([]mount, error) {
+	f, err := os.Open(mountinfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var mounts []mount
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		// the optional fields before the - separator vary in number
+		fields := strings.Fields(scanner.Text())
+		sep := slices.Index(fields, "-")
+		if sep < 6 || len(fields) < sep+3 {
+			return nil, fmt.Errorf("%s: invalid line %q", mountinfoPath, scanner.Text())
+		}
+		mounts = append(mounts, mount{
+			mountpoint: unescapeMountinfo(fields[4]),
+			fstype:     fields[sep+1],
+			device:     unescapeMountinfo(fields[sep+2]),
+			majorMinor: fields[2],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return mounts, nil
+}
+
+// unescapeMountinfo decodes the octal escapes of spaces, tabs, newlines
+// and backslashes in mountinfo paths
+func unescapeMountinfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
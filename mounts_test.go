@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeMountinfo points mountinfoPath to a mountinfo file holding lines
+func writeMountinfo(t *testing.T, lines string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mountinfo")
+	if err := os.WriteFile(path, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := mountinfoPath
+	mountinfoPath = path
+	t.Cleanup(func() { mountinfoPath = old })
+}
+
+func TestReadMounts(t *testing.T) {
+	writeMountinfo(t, `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+36 22 8:17 / /mnt/disk\0401 rw,noatime master:1 shared:2 - xfs /dev/sdb1 rw,attr2
+`)
+	mounts, err := readMounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mount{
+		{mountpoint: "/", fstype: "ext4", device: "/dev/sda1", majorMinor: "8:1"},
+		{mountpoint: "/mnt/disk 1", fstype: "xfs", device: "/dev/sdb1", majorMinor: "8:17"},
+	}
+	if !reflect.DeepEqual(mounts, want) {
+		t.Errorf("got %+v, want %+v", mounts, want)
+	}
+
+	writeMountinfo(t, "22 1 8:1 / / rw,relatime shared:1\n")
+	if _, err := readMounts(); err == nil {
+		t.Error("expected error for a line without separator")
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"disk1", "disk2", "disk3", "disk4", "bind"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeMountinfo(t, fmt.Sprintf(`22 1 8:1 / / rw - ext4 /dev/sda1 rw
+30 22 8:17 / %[1]s/disk1 rw - xfs /dev/sdb1 rw
+31 22 8:33 / %[1]s/disk2 rw - ext4 /dev/sdc1 rw
+32 22 0:40 / %[1]s/disk3 rw - tmpfs tmpfs rw
+33 22 8:49 / %[1]s/disk4 rw - ext4 /dev/sdd1 rw
+34 33 8:65 / %[1]s/disk4 rw - xfs /dev/sde1 rw
+35 22 8:17 /data %[1]s/bind rw - xfs /dev/sdb1 rw
+`, root))
+
+	tests := []struct {
+		name string
+		d    discoveryConfig
+		want []string
+	}{
+		// disk3 is tmpfs, disk4 is mounted over and bind is sdb1 again
+		{"fstypes", discoveryConfig{Mountpoints: root + "/*", Fstypes: []string{"ext4", "xfs"}}, []string{"disk1", "disk2", "disk4"}},
+		{"any fstype", discoveryConfig{Mountpoints: root + "/disk*"}, []string{"disk1", "disk2", "disk3", "disk4"}},
+		{"glob", discoveryConfig{Mountpoints: root + "/disk[12]", Fstypes: []string{"xfs"}}, []string{"disk1"}},
+		{"minSize", discoveryConfig{Mountpoints: root + "/*", MinSize: "1000P"}, nil},
+	}
+	for _, tt := range tests {
+		mounts, err := tt.d.discover()
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		var got []string
+		for _, m := range mounts {
+			got = append(got, filepath.Base(m.mountpoint))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiscoveryCommands(t *testing.T) {
+	root := t.TempDir()
+	writeMountinfo(t, fmt.Sprintf("30 22 8:17 / %s rw - xfs /dev/sdb1 rw\n", root))
+
+	cfg := testConfig()
+	cfg.Discovery = discoveryConfig{Mountpoints: root}
+	cfg.Benchmarks[0].flagTargets = true
+	custom := testDefaults
+	custom.Name, custom.Directory = "own", "/data"
+	cfg.Benchmarks = append(cfg.Benchmarks, custom)
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	benchmarks, err := cfg.commands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(benchmarks[0]) != 1 {
+		t.Fatalf("got %d commands, want 1", len(benchmarks[0]))
+	}
+	bc := benchmarks[0][0]
+	want := series{benchmark: "latency", target: filepath.Join(root, discoveryDir), mountpoint: root, fstype: "xfs", device: "/dev/sdb1"}
+	if bc.series() != want {
+		t.Errorf("got series %+v, want %+v", bc.series(), want)
+	}
+	// a spec with a directory of its own is not discovered
+	if got := benchmarks[1][0].target; got != "/data" {
+		t.Errorf("got target %s, want /data", got)
+	}
+
+	if _, ok := cfg.rediscover("own"); ok {
+		t.Error("rediscovered a benchmark without discovery")
+	}
+	writeMountinfo(t, "")
+	commands, ok := cfg.rediscover("latency")
+	if !ok || len(commands) != 0 {
+		t.Errorf("got %d commands after the mount is gone, ok %v", len(commands), ok)
+	}
+}
+
+func TestDiscoveryFreeFileSize(t *testing.T) {
+	root := t.TempDir()
+	writeMountinfo(t, fmt.Sprintf("30 22 8:17 / %s rw - xfs /dev/sdb1 rw\n", root))
+
+	cfg := testConfig()
+	cfg.AllowTmpfs = true
+	cfg.Discovery = discoveryConfig{Mountpoints: root}
+	cfg.Benchmarks[0].Name = "discovered-free"
+	cfg.Benchmarks[0].FileSize = "free:10%"
+	cfg.Benchmarks[0].flagTargets = true
+	benchmarks, err := cfg.commands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := benchmarks[0][0]
+	// fio is replaced by a command printing no results
+	bc.args = []string{"true"}
+	runBenchmark(context.Background(), bc, &cfg)
+
+	if _, err := os.Stat(bc.target); err != nil {
+		t.Errorf("data file directory not created: %s", err)
+	}
+	run := lastRuns[bc.series()]
+	if run == nil || run.Reason != reasonOutput {
+		t.Errorf("got run %+v, want a run failing with reason %s", run, reasonOutput)
+	}
+}
+
+func TestDiscoveryDirectoryError(t *testing.T) {
+	root := t.TempDir()
+	writeMountinfo(t, fmt.Sprintf("30 22 8:17 / %s rw - xfs /dev/sdb1 rw\n", root))
+	// a file in the way of the data file directory
+	if err := os.WriteFile(filepath.Join(root, discoveryDir), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig()
+	cfg.Discovery = discoveryConfig{Mountpoints: root}
+	cfg.Benchmarks[0].Name = "discovered-mkdir"
+	cfg.Benchmarks[0].flagTargets = true
+	benchmarks, err := cfg.commands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := benchmarks[0][0]
+	runBenchmark(context.Background(), bc, &cfg)
+
+	run := lastRuns[bc.series()]
+	if run == nil || run.Reason != reasonPreflight || !strings.Contains(run.Error, "cannot create the data file directory on "+root) {
+		t.Errorf("got run %+v, want a run failing with reason %s", run, reasonPreflight)
+	}
+}
+
+func TestUnescapeMountinfo(t *testing.T) {
+	for in, want := range map[string]string{
+		`/mnt/a\040b`:    "/mnt/a b",
+		`/mnt/a\134b`:    `/mnt/a\b`,
+		`/mnt/a\tab`:     `/mnt/a\tab`,
+		`/mnt/trailing\`: `/mnt/trailing\`,
+	} {
+		if got := unescapeMountinfo(in); got != want {
+			t.Errorf("%q: got %q, want %q", in, got, want)
+		}
+	}
+}
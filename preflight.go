@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// tmpfsMagic is the statfs type of tmpfs
+const tmpfsMagic = 0x01021994
+
+// dataSpace returns the directory the data files of the job are laid out
+// in and their size in bytes, 0 if the size is unknown or relative. ok is
+// false for jobs running against a block device.
+func (j fioJob) dataSpace() (dir string, size int64, ok bool) {
+	dir = j.directory
+	if dir == "" {
+		dir = "."
+	}
+	// a filename of colons only names no file, fio falls back to the job
+	// directory
+	if files := j.files(); j.filename != "" && len(files) > 0 {
+		if info, err := os.Stat(files[0]); err == nil && !info.Mode().IsRegular() {
+			return "", 0, false
+		}
+		dir = filepath.Dir(files[0])
+	}
+	if size, err := parseFioSize(j.size); err == nil {
+		return dir, size * int64(j.numjobs), true
+	}
+	return dir, 0, true
+}
+
+// preflight checks the directories the data files of a fio command are
+// laid out in before fio runs. A directory must exist, be writable, must
+// not be on tmpfs unless cfg.AllowTmpfs is set and must have room for the
+// data files plus cfg.FreeSpaceMargin.
+func preflight(bc benchmarkCommand, cfg *config) error {
+	var dirs []string
+	need := make(map[string]int64)
+	for _, j := range bc.jobs {
+		dir, size, ok := j.dataSpace()
+		if !ok {
+			continue
+		}
+		if _, seen := need[dir]; !seen {
+			dirs = append(dirs, dir)
+		}
+		need[dir] += size
+	}
+	// existing data files, kept ones or files given with filename, are
+	// reused by fio
+	seen := make(map[string]bool)
+	for _, j := range bc.jobs {
+		for _, pattern := range j.files() {
+			files, _ := filepath.Glob(pattern)
+			for _, file := range files {
+				if seen[file] {
+					continue
+				}
+				seen[file] = true
+				if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+					need[filepath.Dir(file)] -= info.Size()
+				}
+			}
+		}
+	}
+
+	var errs []error
+	for _, dir := range dirs {
+		if err := checkDirectory(bc.series(), dir, need[dir], cfg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkDirectory checks a directory of the data files of a benchmark run
+// that need the given number of bytes and exports its free space
+func checkDirectory(s series, dir string, need int64, cfg *config) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return fmt.Errorf("statfs %s: %w", dir, err)
+	}
+	free := int64(st.Bavail) * int64(st.Bsize)
+	fioTargetFree.WithLabelValues(s.runValues(dir)...).Set(float64(free))
+	if st.Type == tmpfsMagic && !cfg.AllowTmpfs {
+		return fmt.Errorf("%s is on tmpfs, benchmarks measure memory instead of a disk there", dir)
+	}
+
+	f, err := os.CreateTemp(dir, ".fio_benchmark_exporter-")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	margin, err := parseFioSize(cfg.FreeSpaceMargin)
+	if errors.Is(err, errRelativeSize) {
+		var percent float64
+		fmt.Sscanf(cfg.FreeSpaceMargin, "%g%%", &percent)
+		margin = int64(percent / 100 * float64(int64(st.Blocks)*int64(st.Bsize)))
+	}
+	if need > 0 && need+margin > free {
+		return fmt.Errorf("%s has %s free, the data files need %s plus a freeSpaceMargin of %s",
+			dir, formatBytes(free), formatBytes(need), formatBytes(margin))
+	}
+	return nil
+}
+
+// formatBytes formats a number of bytes with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
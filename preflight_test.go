@@ -0,0 +1,90 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPreflight(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig()
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Type == tmpfsMagic {
+		cfg.AllowTmpfs = true
+	}
+
+	bc := benchmarkCommand{benchmark: "preflight", jobs: []fioJob{{name: "a", directory: dir, size: "4k", numjobs: 2}}}
+	if err := preflight(bc, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if v := testutil.ToFloat64(fioTargetFree.WithLabelValues(series{benchmark: "preflight"}.runValues(dir)...)); v <= 0 {
+		t.Errorf("got free bytes %v", v)
+	}
+
+	bc.jobs[0].size = "1000P"
+	if err := preflight(bc, &cfg); err == nil || !strings.Contains(err.Error(), "free") {
+		t.Errorf("data files larger than the filesystem: got %v", err)
+	}
+
+	bc.jobs[0].directory = filepath.Join(dir, "missing")
+	if err := preflight(bc, &cfg); err == nil {
+		t.Error("missing directory: expected error")
+	}
+
+	// the size of jobs against a block device is not checked
+	bc.jobs[0] = fioJob{name: "dev", filename: "/dev/null", size: "1000P", numjobs: 1}
+	if err := preflight(bc, &cfg); err != nil {
+		t.Errorf("block device: %s", err)
+	}
+}
+
+func TestDataSpace(t *testing.T) {
+	tests := []struct {
+		job  fioJob
+		dir  string
+		size int64
+	}{
+		{fioJob{name: "a", size: "4k", numjobs: 2}, ".", 8192},
+		{fioJob{name: "a", directory: "/data", size: "10%", numjobs: 1}, "/data", 0},
+		{fioJob{name: "a", directory: "/data", filename: "/mnt/f1:/mnt/f2", numjobs: 1}, "/mnt", 0},
+		// a filename naming no file falls back to the job directory
+		{fioJob{name: "a", directory: "/data", filename: ":", size: "1k", numjobs: 1}, "/data", 1024},
+	}
+	for _, tt := range tests {
+		dir, size, ok := tt.job.dataSpace()
+		if dir != tt.dir || size != tt.size || !ok {
+			t.Errorf("%+v: got %s, %d, %v, want %s, %d", tt.job, dir, size, ok, tt.dir, tt.size)
+		}
+	}
+}
+
+func TestPreflightTmpfs(t *testing.T) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs("/dev/shm", &st); err != nil || st.Type != tmpfsMagic {
+		t.Skip("/dev/shm is not on tmpfs")
+	}
+	cfg := testConfig()
+	bc := benchmarkCommand{benchmark: "tmpfs", jobs: []fioJob{{name: "a", directory: "/dev/shm", size: "4k", numjobs: 1}}}
+	if err := preflight(bc, &cfg); err == nil {
+		t.Error("tmpfs: expected error")
+	}
+	cfg.AllowTmpfs = true
+	if err := preflight(bc, &cfg); err != nil {
+		t.Errorf("tmpfs allowed: %s", err)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{512: "512B", 1536: "1.5KiB", 10 << 30: "10.0GiB"} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("%d: got %s, want %s", n, got, want)
+		}
+	}
+}
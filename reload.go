@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// reloader reloads the config on SIGHUP, on a request to /-/reload or when
+// the config file changes. A config that fails validation is rejected and
+// the running config is kept.
+type reloader struct {
+	// mu serializes reloads
+	mu     sync.Mutex
+	load   func() (*config, error)
+	runner *runner
+}
+
+// reload loads and applies the config, source is logged with the result
+func (rl *reloader) reload(source string) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	cfg, err := rl.load()
+	if err == nil {
+		err = rl.runner.apply(cfg)
+	}
+	if err != nil {
+		log.Printf("Error reloading config on %s, keeping the running config:\n%s\n", source, err)
+		return err
+	}
+	log.Printf("Reloaded config on %s\n", source)
+	return nil
+}
+
+// handleSignals reloads the config on every SIGHUP
+func (rl *reloader) handleSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		rl.reload("SIGHUP")
+	}
+}
+
+// ServeHTTP reloads the config on a POST or PUT request
+func (rl *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost && req.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "use POST or PUT to reload the config", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := rl.reload("request from " + req.RemoteAddr); err != nil {
+		http.Error(w, fmt.Sprintf("error reloading config:\n%s", err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, "config reloaded")
+}
+
+// watch reloads the config when the modification time of the file at path
+// changes, checking every interval
+func (rl *reloader) watch(path string, interval time.Duration) {
+	var last time.Time
+	if info, err := os.Stat(path); err == nil {
+		last = info.ModTime()
+	}
+	for range time.Tick(interval) {
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Printf("Error checking config file: %s\n", err)
+			continue
+		}
+		if info.ModTime().Equal(last) {
+			continue
+		}
+		last = info.ModTime()
+		rl.reload("change of " + path)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// scheduler serializes the runs of all benchmarks, fio runs against the
+// same disks at the same time would distort each other's results
+type scheduler struct {
+	mu      sync.Mutex
+	queue   []string
+	pending map[string]bool
+	// ready is signaled when a benchmark is queued
+	ready chan struct{}
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		pending: make(map[string]bool),
+		ready:   make(chan struct{}, 1),
+	}
+}
+
+// enqueue queues a run of a benchmark unless one is already waiting
+func (s *scheduler) enqueue(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending[name] {
+		log.Printf("Benchmark %s is already queued, skipping\n", name)
+		return
+	}
+	s.pending[name] = true
+	s.queue = append(s.queue, name)
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// next waits for the next queued benchmark until ctx is done
+func (s *scheduler) next(ctx context.Context) (string, error) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			name := s.queue[0]
+			s.queue = s.queue[1:]
+			delete(s.pending, name)
+			s.mu.Unlock()
+			return name, nil
+		}
+		s.mu.Unlock()
+		select {
+		case <-s.ready:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// runner runs the benchmarks of the current config on their schedules,
+// apply swaps in a new config without interrupting a running benchmark
+type runner struct {
+	sched *scheduler
+
+	mu         sync.Mutex
+	cfg        *config
+	benchmarks map[string][]benchmarkCommand
+	cron       *cron.Cron
+	// stopped is set on shutdown, the schedules are not started again
+	stopped bool
+	// retries counts the retries of failed benchmarks
+	retries map[string]int
+}
+
+func newRunner() *runner {
+	return &runner{
+		sched:   newScheduler(),
+		retries: make(map[string]int),
+	}
+}
+
+// apply replaces the config and the benchmark schedules, cfg must be
+// validated. Queued runs of benchmarks that are no longer configured are
+// skipped and metrics of earlier runs are kept.
+func (r *runner) apply(cfg *config) error {
+	commands, err := cfg.commands()
+	if err != nil {
+		return err
+	}
+	benchmarks := make(map[string][]benchmarkCommand, len(cfg.Benchmarks))
+	for i, spec := range cfg.Benchmarks {
+		benchmarks[spec.Name] = commands[i]
+	}
+
+	// create cron if needed
+	var c *cron.Cron
+	if !cfg.RunOnce {
+		c = cron.New()
+		for _, spec := range cfg.Benchmarks {
+			name := spec.Name
+			// schedules are checked by validate
+			c.AddFunc(spec.CronSchedule, func() {
+				log.Printf("Cron queueing benchmark %s\n", name)
+				r.sched.enqueue(name)
+			})
+			log.Printf("Configured schedule for %s: %s\n", spec.Name, spec.CronSchedule)
+		}
+	}
+
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return errors.New("the exporter is shutting down")
+	}
+	old, oldCfg := r.cron, r.cfg
+	r.cfg, r.benchmarks, r.cron = cfg, benchmarks, c
+	r.mu.Unlock()
+
+	// stopping the cron does not affect a benchmark that already runs
+	if old != nil {
+		old.Stop()
+	}
+	if c != nil {
+		c.Start()
+	}
+	if oldCfg != nil {
+		if changes := oldCfg.restartChanges(cfg); len(changes) > 0 {
+			log.Printf("Changes to %s take effect after a restart\n", strings.Join(changes, ", "))
+		}
+	}
+	return nil
+}
+
+// config returns the current config
+func (r *runner) config() *config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cfg
+}
+
+// stop stops the benchmark schedules for good, a benchmark that is running
+// or queued is stopped by cancelling the context of run
+func (r *runner) stop() {
+	r.mu.Lock()
+	c := r.cron
+	r.cron, r.stopped = nil, true
+	r.mu.Unlock()
+	if c != nil {
+		<-c.Stop().Done()
+	}
+}
+
+// sweep removes the data files left behind by earlier runs of every
+// benchmark, e.g. by an exporter that crashed during a run
+func (r *runner) sweep() {
+	r.mu.Lock()
+	benchmarks := r.benchmarks
+	r.mu.Unlock()
+	for _, commands := range benchmarks {
+		for _, bc := range commands {
+			bc, err := bc.resolveTarget()
+			if err != nil {
+				log.Printf("Benchmark %s: %s\n", bc.benchmark, err)
+				continue
+			}
+			removeFiles(bc)
+		}
+	}
+}
+
+// queueAll queues a run of every benchmark
+func (r *runner) queueAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, spec := range r.cfg.Benchmarks {
+		r.sched.enqueue(spec.Name)
+	}
+}
+
+// run runs the queued benchmarks one at a time until ctx is done, a fio
+// command running at that time is killed. The data files of every run are
+// removed unless cfg.KeepDataFiles is set.
+func (r *runner) run(ctx context.Context) {
+	// with runOnce a benchmark is done once it succeeded or ran out of
+	// retries
+	done := 0
+	failed := false
+	for {
+		name, err := r.sched.next(ctx)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		commands, ok := r.benchmarks[name]
+		cfg := r.cfg
+		r.mu.Unlock()
+		if !ok {
+			log.Printf("Benchmark %s is no longer configured, skipping\n", name)
+			continue
+		}
+		// mounts are discovered before every run, a new disk is benchmarked
+		// without a config change
+		if discovered, ok := cfg.rediscover(name); ok {
+			commands = discovered
+		}
+		// job file sections run one after the other
+		for _, bc := range commands {
+			// the run and the removal of its data files share the labels of
+			// the resolved target, a target never resolved is not run
+			bc, e := bc.resolveTarget()
+			if e != nil {
+				err = recordFailure(newRunRecord(bc), reasonPreflight, e)
+				continue
+			}
+			if e := runBenchmark(ctx, bc, cfg); e != nil {
+				err = e
+			}
+			if !cfg.KeepDataFiles {
+				removeFiles(bc)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
+		if r.retry(name, err, cfg) {
+			continue
+		}
+		done++
+		failed = failed || err != nil
+		if cfg.RunOnce && done == len(cfg.Benchmarks) {
+			log.Printf("Waiting for runOnceWait of %s to expire", cfg.RunOnceWait)
+			select {
+			case <-time.After(cfg.RunOnceWait):
+			case <-ctx.Done():
+				return
+			}
+			if failed {
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+	}
+}
+
+// retry queues another run of a failed benchmark after a backoff that
+// doubles with every retry and reports whether it did. Retries stop with a
+// successful run or after cfg.RetryAttempts, the benchmark then waits for
+// its next scheduled run.
+func (r *runner) retry(name string, err error, cfg *config) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attempt := r.retries[name]
+	if err == nil || attempt >= cfg.RetryAttempts {
+		if err != nil && cfg.RetryAttempts > 0 {
+			log.Printf("Benchmark %s failed after %d retries\n", name, attempt)
+		}
+		delete(r.retries, name)
+		return false
+	}
+	r.retries[name] = attempt + 1
+	backoff := cfg.RetryBackoff << attempt
+	log.Printf("Retrying benchmark %s in %s, retry %d of %d\n", name, backoff, attempt+1, cfg.RetryAttempts)
+	time.AfterFunc(backoff, func() { r.sched.enqueue(name) })
+	return true
+}
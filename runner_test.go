@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSchedulerQueuesOnce(t *testing.T) {
+	s := newScheduler()
+	s.enqueue("throughput")
+	s.enqueue("latency")
+	s.enqueue("throughput")
+	if name, _ := s.next(context.Background()); name != "throughput" {
+		t.Errorf("got %s, want throughput", name)
+	}
+	// throughput may be queued again once it started
+	s.enqueue("throughput")
+	for _, want := range []string{"latency", "throughput"} {
+		if name, _ := s.next(context.Background()); name != want {
+			t.Errorf("got %s, want %s", name, want)
+		}
+	}
+	if len(s.queue) != 0 {
+		t.Errorf("got %d queued, want 0", len(s.queue))
+	}
+}
+
+func TestRunnerApply(t *testing.T) {
+	cfg := testConfig()
+	cfg.RunOnce = true
+	r := newRunner()
+	if err := r.apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.benchmarks["latency"]; !ok {
+		t.Fatalf("got benchmarks %v, want latency", r.benchmarks)
+	}
+
+	next := testConfig()
+	next.RunOnce = true
+	next.Benchmarks = []benchmarkSpec{testDefaults, testDefaults}
+	next.Benchmarks[0].Name = "hourly"
+	next.Benchmarks[1].Name = "nightly"
+	if err := r.apply(&next); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.benchmarks["latency"]; ok {
+		t.Error("latency still configured after apply")
+	}
+	if len(r.benchmarks) != 2 || r.cfg != &next {
+		t.Errorf("got benchmarks %v", r.benchmarks)
+	}
+}
+
+func TestReloaderKeepsConfigOnError(t *testing.T) {
+	cfg := testConfig()
+	cfg.RunOnce = true
+	r := newRunner()
+	if err := r.apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	rl := &reloader{
+		load:   func() (*config, error) { return nil, errors.New("invalid outputFormat") },
+		runner: r,
+	}
+
+	rec := httptest.NewRecorder()
+	rl.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/-/reload", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	rec = httptest.NewRecorder()
+	rl.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("POST invalid config: got status %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if r.cfg != &cfg {
+		t.Error("running config replaced by invalid config")
+	}
+
+	next := testConfig()
+	next.RunOnce = true
+	rl.load = func() (*config, error) { return &next, nil }
+	rec = httptest.NewRecorder()
+	rl.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("POST: got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	if r.cfg != &next {
+		t.Error("running config not replaced")
+	}
+}
+
+func TestRunnerRetry(t *testing.T) {
+	cfg := testConfig()
+	cfg.RetryAttempts = 2
+	cfg.RetryBackoff = time.Millisecond
+	r := newRunner()
+	failed := errors.New("fio command error")
+
+	for i := 0; i < 2; i++ {
+		if !r.retry("latency", failed, &cfg) {
+			t.Fatalf("retry %d: not queued", i+1)
+		}
+		if name, _ := r.sched.next(context.Background()); name != "latency" {
+			t.Errorf("retry %d: got %s, want latency", i+1, name)
+		}
+	}
+	if r.retry("latency", failed, &cfg) {
+		t.Error("queued a retry after retryAttempts")
+	}
+
+	// the next scheduled run starts with fresh retries
+	if !r.retry("latency", failed, &cfg) {
+		t.Error("no retry after running out of retries earlier")
+	}
+	if r.retry("latency", nil, &cfg) {
+		t.Error("queued a retry of a successful run")
+	}
+	if len(r.retries) != 0 {
+		t.Errorf("got retries %v, want none", r.retries)
+	}
+}
+
+func TestRunnerShutdown(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "stop.0.0")
+	cfg := testConfig()
+	cfg.RunOnce = true
+	r := newRunner()
+	if err := r.apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	// the fio command lays out a data file and runs until it is killed
+	r.benchmarks["latency"] = []benchmarkCommand{{
+		benchmark: "stop",
+		args:      []string{"sh", "-c", "echo data > " + data + "; sleep 60 & wait"},
+		files:     []string{filepath.Join(dir, "stop.[0-9]*.[0-9]*")},
+	}}
+	r.queueAll()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		r.run(ctx)
+		close(stopped)
+	}()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(data); err == nil {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("fio command did not start")
+		}
+	}
+	r.stop()
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after cancel")
+	}
+	if _, err := os.Stat(data); !os.IsNotExist(err) {
+		t.Errorf("data file not removed: %v", err)
+	}
+	if err := r.apply(&cfg); err == nil {
+		t.Error("apply after stop: expected error")
+	}
+}
+
+func TestRunnerResolvesTarget(t *testing.T) {
+	dir := t.TempDir()
+	var st syscall.Stat_t
+	if err := syscall.Stat(dir, &st); err != nil {
+		t.Fatal(err)
+	}
+	writeMountinfo(t, fmt.Sprintf("30 22 %s / %s rw - xfs /dev/sdb1 rw\n", formatDevice(st.Dev), dir))
+	data := filepath.Join(dir, "resolved.0.0")
+	if err := os.WriteFile(data, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig()
+	cfg.RunOnce = true
+	r := newRunner()
+	if err := r.apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	r.benchmarks["latency"] = []benchmarkCommand{{
+		benchmark: "resolved",
+		target:    dir,
+		args:      []string{"true"},
+		files:     []string{filepath.Join(dir, "resolved.[0-9]*.[0-9]*")},
+	}}
+	r.queueAll()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		r.run(ctx)
+		close(stopped)
+	}()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(data); os.IsNotExist(err) {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("data file not removed")
+		}
+	}
+	r.stop()
+	cancel()
+	<-stopped
+
+	// the run and the removal of its data files are labelled alike
+	s := series{benchmark: "resolved", target: dir, mountpoint: dir, fstype: "xfs", device: "/dev/sdb1"}
+	if run := lastRuns[s]; run == nil {
+		t.Errorf("no run recorded for %+v", s)
+	}
+	if v := testutil.ToFloat64(fioDataFilesRemoved.WithLabelValues(s.runValues()...)); v != 10 {
+		t.Errorf("got %v bytes removed, want 10", v)
+	}
+}
+
+func TestRunnerUnresolvedTarget(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "missing")
+	cfg := testConfig()
+	cfg.RunOnce = true
+	r := newRunner()
+	if err := r.apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	r.benchmarks["latency"] = []benchmarkCommand{{benchmark: "unresolved", target: target, args: []string{"true"}}}
+	r.queueAll()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		r.run(ctx)
+		close(stopped)
+	}()
+	// a target without a mount is not run and has no mount labels
+	s := series{benchmark: "unresolved", target: target}
+	var run *runRecord
+	for start := time.Now(); run == nil; time.Sleep(10 * time.Millisecond) {
+		runsMu.Lock()
+		run = lastRuns[s]
+		runsMu.Unlock()
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("no run recorded")
+		}
+	}
+	r.stop()
+	cancel()
+	<-stopped
+
+	if run.Reason != reasonPreflight || !strings.Contains(run.Error, "resolving the device of target") {
+		t.Errorf("got run %+v, want a run failing with reason %s", run, reasonPreflight)
+	}
+}
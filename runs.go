@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fritchie/fio_benchmark_exporter/terseparser"
+)
+
+// reasons a benchmark run fails for
+const (
+	// reasonPreflight is a benchmark directory without room for the data
+	// files, not writable or on tmpfs
+	reasonPreflight = "preflight"
+	// reasonStart is a fio command that could not be started
+	reasonStart = "start"
+	// reasonExit is a fio command exiting with an error
+	reasonExit = "exit"
+	// reasonOutput is fio output without any result
+	reasonOutput = "output"
+	// reasonTimeout is a fio command killed after the run timeout
+	reasonTimeout = "timeout"
+)
+
+// maxStderr limits the fio stderr kept in a run record, with
+// --continue_on_error fio prints a line for every failed IO
+const maxStderr = 64 * 1024
+
+// runRecord describes the last fio run of a benchmark
+type runRecord struct {
+	Benchmark string `json:"benchmark"`
+	Target    string `json:"target,omitempty"`
+	// Mountpoint, Fstype and Device describe the mount or device of Target
+	Mountpoint string    `json:"mountpoint,omitempty"`
+	Fstype     string    `json:"fstype,omitempty"`
+	Device     string    `json:"device,omitempty"`
+	Command    string    `json:"command"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Error      string    `json:"error,omitempty"`
+	// Reason is the reason label of fio_benchmark_failures_total
+	Reason     string `json:"reason,omitempty"`
+	Errors     int64  `json:"errors"`
+	FirstError int    `json:"firstError"`
+	// FirstErrorDescription is the errno description of FirstError
+	FirstErrorDescription string `json:"firstErrorDescription,omitempty"`
+	Stderr                string `json:"stderr,omitempty"`
+}
+
+var (
+	runsMu sync.Mutex
+	// lastRuns holds the last run of every benchmark and target
+	lastRuns = make(map[series]*runRecord)
+)
+
+// setStderr keeps the tail of the fio stderr output
+func (r *runRecord) setStderr(stderr []byte) {
+	if len(stderr) > maxStderr {
+		stderr = stderr[len(stderr)-maxStderr:]
+	}
+	r.Stderr = string(stderr)
+}
+
+// setErrors records the IO errors fio reported for the run, the errors of
+// all jobs are added up
+func (r *runRecord) setErrors(results []*terseparser.Result) {
+	r.Errors = 0
+	r.FirstError = 0
+	r.FirstErrorDescription = ""
+	for _, result := range results {
+		r.Errors += result.TotalErrors
+		if r.FirstError == 0 {
+			r.FirstError = result.FirstError
+		}
+	}
+	if r.FirstError != 0 {
+		r.FirstErrorDescription = syscall.Errno(r.FirstError).Error()
+	}
+}
+
+// series returns the series of the benchmark run
+func (r *runRecord) series() series {
+	return series{
+		benchmark:  r.Benchmark,
+		target:     r.Target,
+		mountpoint: r.Mountpoint,
+		fstype:     r.Fstype,
+		device:     r.Device,
+	}
+}
+
+// newRunRecord returns the record of a run of a fio command starting now
+func newRunRecord(bc benchmarkCommand) *runRecord {
+	return &runRecord{
+		Benchmark:  bc.benchmark,
+		Target:     bc.target,
+		Mountpoint: bc.mount.mountpoint,
+		Fstype:     bc.mount.fstype,
+		Device:     bc.mount.device,
+		Command:    bc.String(),
+		Start:      time.Now(),
+	}
+}
+
+// recordRun stores the record of a finished run
+func recordRun(r *runRecord) {
+	runsMu.Lock()
+	defer runsMu.Unlock()
+	lastRuns[r.series()] = r
+}
+
+// recordFailure stores the record of a failed run and marks the benchmark
+// as failed, the returned error describes the failure
+func recordFailure(r *runRecord, reason string, err error) error {
+	r.End = time.Now()
+	r.Error = err.Error()
+	r.Reason = reason
+	recordRun(r)
+	fioBenchmarkSuccess.WithLabelValues(r.series().runValues()...).Set(0)
+	fioBenchmarkFailures.WithLabelValues(r.series().runValues(reason)...).Inc()
+	log.Printf("Benchmark %s failed (%s): %s\n", r.Benchmark, reason, err)
+	return err
+}
+
+// runsHandler serves the last run record of every benchmark as JSON
+func runsHandler(w http.ResponseWriter, req *http.Request) {
+	runsMu.Lock()
+	runs := make([]*runRecord, 0, len(lastRuns))
+	for _, r := range lastRuns {
+		runs = append(runs, r)
+	}
+	runsMu.Unlock()
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].Benchmark != runs[j].Benchmark {
+			return runs[i].Benchmark < runs[j].Benchmark
+		}
+		return runs[i].Target < runs[j].Target
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(runs); err != nil {
+		log.Printf("Error writing runs: %s\n", err)
+	}
+}
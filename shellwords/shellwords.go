@@ -0,0 +1,116 @@
+// Package shellwords splits a string into words following the quoting
+// rules of the POSIX shell
+//
+// Only quoting is supported, there is no expansion of variables, commands
+// or globs, so a string is split the same way on every host.
+package shellwords
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrUnterminatedQuote is returned for a quote without a closing quote
+	ErrUnterminatedQuote = errors.New("unterminated quote")
+	// ErrTrailingBackslash is returned for a backslash at the end of input
+	ErrTrailingBackslash = errors.New("backslash at end of input")
+)
+
+// Split splits s into words separated by unquoted blanks and newlines.
+// Single quotes preserve every character up to the next single quote,
+// double quotes preserve every character except a backslash escaping $, `,
+// ", \ or a newline. Outside of quotes a backslash preserves the next
+// character, a backslash followed by a newline is removed.
+func Split(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	// inWord tracks words that are empty but quoted, like ''
+	inWord := false
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			i++
+			if i == len(runes) {
+				return nil, ErrTrailingBackslash
+			}
+			if runes[i] == '\n' {
+				continue
+			}
+			word.WriteRune(runes[i])
+			inWord = true
+		case c == '\'':
+			end := indexRune(runes, i+1, '\'')
+			if end < 0 {
+				return nil, ErrUnterminatedQuote
+			}
+			word.WriteString(string(runes[i+1 : end]))
+			i = end
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					switch runes[i+1] {
+					case '$', '`', '"', '\\':
+						i++
+					case '\n':
+						i++
+						continue
+					}
+				}
+				word.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, ErrUnterminatedQuote
+			}
+			inWord = true
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+func indexRune(runes []rune, from int, r rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// Join quotes every word that needs quoting and joins the words with
+// spaces, Split of the result returns the words
+func Join(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = Quote(w)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Quote returns w unchanged if the shell would read it as a single word,
+// otherwise w in single quotes
+func Quote(w string) string {
+	if w == "" {
+		return "''"
+	}
+	if !strings.ContainsAny(w, " \t\n'\"\\$`;&|<>()*?[]#~{}!") {
+		return w
+	}
+	return "'" + strings.ReplaceAll(w, "'", `'\''`) + "'"
+}
@@ -0,0 +1,78 @@
+package shellwords
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"--name=latency --bs=4k", []string{"--name=latency", "--bs=4k"}},
+		{"  --bs=4k   --iodepth=1  ", []string{"--bs=4k", "--iodepth=1"}},
+		{"--bs=4k\t--iodepth=1\n--direct=1", []string{"--bs=4k", "--iodepth=1", "--direct=1"}},
+		{`--filename="/mnt/my disk/f"`, []string{"--filename=/mnt/my disk/f"}},
+		{`--description='nightly run'`, []string{"--description=nightly run"}},
+		{`--description="it's nightly"`, []string{"--description=it's nightly"}},
+		{`--description='say "hi"'`, []string{`--description=say "hi"`}},
+		{`--filename=/mnt/my\ disk/f`, []string{"--filename=/mnt/my disk/f"}},
+		{`"a"'b'c`, []string{"abc"}},
+		{`'' ""`, []string{"", ""}},
+		{`--description=''`, []string{"--description="}},
+		{`"\$HOME \"x\" \\ \a"`, []string{`$HOME "x" \ \a`}},
+		{`'\$HOME \n'`, []string{`\$HOME \n`}},
+		{`$HOME ~ *`, []string{"$HOME", "~", "*"}},
+		{"--bs=4k \\\n--iodepth=1", []string{"--bs=4k", "--iodepth=1"}},
+		{"\"line\\\ncontinued\"", []string{"linecontinued"}},
+		{"\"two\nlines\"", []string{"two\nlines"}},
+		{`--filename="/mnt/ü disk"`, []string{"--filename=/mnt/ü disk"}},
+	}
+	for _, tt := range tests {
+		got, err := Split(tt.in)
+		if err != nil {
+			t.Errorf("Split(%q): %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Split(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	tests := []struct {
+		in   string
+		want error
+	}{
+		{`--filename="/mnt/my disk/f`, ErrUnterminatedQuote},
+		{`--description='nightly run`, ErrUnterminatedQuote},
+		{`"a\"`, ErrUnterminatedQuote},
+		{`--bs=4k \`, ErrTrailingBackslash},
+	}
+	for _, tt := range tests {
+		if _, err := Split(tt.in); !errors.Is(err, tt.want) {
+			t.Errorf("Split(%q): got %v, want %v", tt.in, err, tt.want)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	words := []string{"fio", "--name=latency", "--filename=/mnt/my disk/f", "--description=it's", "", `a"b`, "$HOME"}
+	joined := Join(words)
+	want := `fio --name=latency '--filename=/mnt/my disk/f' '--description=it'\''s' '' 'a"b' '$HOME'`
+	if joined != want {
+		t.Errorf("Join = %s, want %s", joined, want)
+	}
+	got, err := Split(joined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, words) {
+		t.Errorf("Split(Join(words)) = %q, want %q", got, words)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sysfsPath is read for the attributes of block devices
+var sysfsPath = "/sys"
+
+// blockDeviceInfo holds the sysfs attributes of a disk, empty if the disk
+// does not report one
+type blockDeviceInfo struct {
+	model            string
+	serial           string
+	rotational       string
+	scheduler        string
+	logicalBlockSize string
+	nrRequests       string
+}
+
+// readBlockDeviceInfo reads the attributes of the disk with the device
+// number majorMinor, of the disk holding it for a partition
+func readBlockDeviceInfo(majorMinor string) (blockDeviceInfo, error) {
+	path, err := filepath.EvalSymlinks(filepath.Join(sysfsPath, "dev", "block", majorMinor))
+	if err != nil {
+		return blockDeviceInfo{}, err
+	}
+	name := filepath.Base(path)
+	if _, err := os.Stat(filepath.Join(path, "partition")); err == nil {
+		name = filepath.Base(filepath.Dir(path))
+	}
+	disk := filepath.Join(sysfsPath, "block", name)
+	info := blockDeviceInfo{
+		model:            readSysfs(disk, "device/model"),
+		serial:           readSysfs(disk, "device/serial"),
+		rotational:       readSysfs(disk, "queue/rotational"),
+		scheduler:        readSysfs(disk, "queue/scheduler"),
+		logicalBlockSize: readSysfs(disk, "queue/logical_block_size"),
+		nrRequests:       readSysfs(disk, "queue/nr_requests"),
+	}
+	// virtio disks report their serial next to the queue
+	if info.serial == "" {
+		info.serial = readSysfs(disk, "serial")
+	}
+	// the active scheduler is bracketed, e.g. none [mq-deadline] kyber
+	if _, active, ok := strings.Cut(info.scheduler, "["); ok {
+		info.scheduler, _, _ = strings.Cut(active, "]")
+	}
+	return info, nil
+}
+
+// readSysfs returns the trimmed content of the attribute file of dir,
+// empty if it cannot be read
+func readSysfs(dir, attr string) string {
+	data, err := os.ReadFile(filepath.Join(dir, attr))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// formatDevice formats a Linux device number as major:minor
+func formatDevice(dev uint64) string {
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+	return fmt.Sprintf("%d:%d", major, minor)
+}
+
+// targetMount returns the mount holding a directory target, or a mount
+// without mount point and filesystem for a block device target
+func targetMount(target string) (mount, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(target, &st); err != nil {
+		return mount{}, fmt.Errorf("stat %s: %w", target, err)
+	}
+	if st.Mode&syscall.S_IFMT == syscall.S_IFBLK {
+		return mount{device: target, majorMinor: formatDevice(st.Rdev)}, nil
+	}
+	path, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		return mount{}, err
+	}
+	mounts, err := readMounts()
+	if err != nil {
+		return mount{}, err
+	}
+	// the filesystem of target mounted at the longest mount point holding
+	// it, the last mount at a mount point hides the earlier ones
+	majorMinor := formatDevice(st.Dev)
+	found := -1
+	for i, m := range mounts {
+		within := m.mountpoint == "/" || path == m.mountpoint || strings.HasPrefix(path, m.mountpoint+"/")
+		if m.majorMinor == majorMinor && within && (found < 0 || len(m.mountpoint) >= len(mounts[found].mountpoint)) {
+			found = i
+		}
+	}
+	if found < 0 {
+		return mount{}, fmt.Errorf("no mount of %s in %s", target, mountinfoPath)
+	}
+	return mounts[found], nil
+}
+
+var (
+	resolvedMu sync.Mutex
+	// resolvedMounts holds the last mount resolved for every target
+	resolvedMounts = make(map[string]mount)
+)
+
+// resolveTarget returns bc with the mount of its target and exports the
+// metadata of the block device backing it. A target that cannot be
+// resolved keeps the mount resolved on an earlier run, so its series keep
+// their labels, an error is returned if there is none.
+func (bc benchmarkCommand) resolveTarget() (benchmarkCommand, error) {
+	if bc.target == "" {
+		return bc, nil
+	}
+	// discovered targets know their mount
+	if bc.mount.device == "" {
+		m, err := targetMount(bc.target)
+		resolvedMu.Lock()
+		if err == nil {
+			resolvedMounts[bc.target] = m
+		} else if last, ok := resolvedMounts[bc.target]; ok {
+			log.Printf("Resolving the device of target %s: %s, keeping %s\n", bc.target, err, last.device)
+			m, err = last, nil
+		}
+		resolvedMu.Unlock()
+		if err != nil {
+			return bc, fmt.Errorf("resolving the device of target %s: %w", bc.target, err)
+		}
+		bc.mount = m
+	}
+	// filesystems without a block device of their own, e.g. tmpfs or
+	// overlay, are exported without disk attributes
+	info, _ := readBlockDeviceInfo(bc.mount.majorMinor)
+	fioTargetInfo.DeletePartialMatch(prometheus.Labels{"device": bc.mount.device})
+	fioTargetInfo.WithLabelValues(
+		bc.mount.device,
+		info.model,
+		info.serial,
+		info.rotational,
+		info.scheduler,
+		info.logicalBlockSize,
+		info.nrRequests,
+		bc.mount.fstype,
+	).Set(1)
+	return bc, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// writeSysfs points sysfsPath to a sysfs tree holding the disk sdb with
+// the partition sdb1, 8:17
+func writeSysfs(t *testing.T) {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"devices/pci0000:00/block/sdb/device/model":             "Samsung SSD 870  \n",
+		"devices/pci0000:00/block/sdb/device/serial":            "S5Y1NX0R123456\n",
+		"devices/pci0000:00/block/sdb/queue/rotational":         "0\n",
+		"devices/pci0000:00/block/sdb/queue/scheduler":          "none [mq-deadline] kyber bfq\n",
+		"devices/pci0000:00/block/sdb/queue/logical_block_size": "512\n",
+		"devices/pci0000:00/block/sdb/queue/nr_requests":        "64\n",
+		"devices/pci0000:00/block/sdb/sdb1/partition":           "1\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, dest := range map[string]string{
+		"block/sdb":      "../devices/pci0000:00/block/sdb",
+		"dev/block/8:17": "../../devices/pci0000:00/block/sdb/sdb1",
+	} {
+		path := filepath.Join(root, link)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(dest, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := sysfsPath
+	sysfsPath = root
+	t.Cleanup(func() { sysfsPath = old })
+}
+
+func TestReadBlockDeviceInfo(t *testing.T) {
+	writeSysfs(t)
+	info, err := readBlockDeviceInfo("8:17")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := blockDeviceInfo{
+		model:            "Samsung SSD 870",
+		serial:           "S5Y1NX0R123456",
+		rotational:       "0",
+		scheduler:        "mq-deadline",
+		logicalBlockSize: "512",
+		nrRequests:       "64",
+	}
+	if info != want {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+	if _, err := readBlockDeviceInfo("0:40"); err == nil {
+		t.Error("expected error for a device without sysfs entry")
+	}
+}
+
+func TestFormatDevice(t *testing.T) {
+	for dev, want := range map[uint64]string{
+		0x811:    "8:17",
+		0x10300:  "259:0",
+		0x100800: "8:256",
+	} {
+		if got := formatDevice(dev); got != want {
+			t.Errorf("%#x: got %s, want %s", dev, got, want)
+		}
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	writeSysfs(t)
+	dir := t.TempDir()
+	var st syscall.Stat_t
+	if err := syscall.Stat(dir, &st); err != nil {
+		t.Fatal(err)
+	}
+	// dir is on a filesystem with the device number of sdb1, the mount of
+	// the parent directory is the longest mount point holding it
+	writeMountinfo(t, fmt.Sprintf(`22 1 %[1]s / / rw - ext4 /dev/sda1 rw
+30 22 %[1]s / %[2]s rw - xfs /dev/sdb1 rw
+31 22 8:33 / %[3]s rw - ext4 /dev/sdc1 rw
+`, formatDevice(st.Dev), filepath.Dir(dir), dir+"-other"))
+	// the sysfs tree has the device number of sdb1
+	if err := os.Rename(filepath.Join(sysfsPath, "dev", "block", "8:17"), filepath.Join(sysfsPath, "dev", "block", formatDevice(st.Dev))); err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := benchmarkCommand{benchmark: "info", target: dir}.resolveTarget()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := series{benchmark: "info", target: dir, mountpoint: filepath.Dir(dir), fstype: "xfs", device: "/dev/sdb1"}
+	if bc.series() != want {
+		t.Errorf("got series %+v, want %+v", bc.series(), want)
+	}
+	g, err := fioTargetInfo.GetMetricWithLabelValues("/dev/sdb1", "Samsung SSD 870", "S5Y1NX0R123456", "0", "mq-deadline", "512", "64", "xfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := testutil.ToFloat64(g); v != 1 {
+		t.Errorf("got fio_target_info %g, want 1", v)
+	}
+
+	// a target that cannot be resolved keeps its last mount
+	writeMountinfo(t, "")
+	bc, err = benchmarkCommand{benchmark: "info", target: dir}.resolveTarget()
+	if err != nil || bc.series() != want {
+		t.Errorf("unresolved target: got series %+v, %v, want %+v", bc.series(), err, want)
+	}
+	if _, err := (benchmarkCommand{benchmark: "info", target: filepath.Join(dir, "missing")}).resolveTarget(); err == nil {
+		t.Error("missing target: expected error")
+	}
+}
@@ -0,0 +1,437 @@
+// Package terseparser parses fio terse version 5 output
+//
+// fio prints all stats for a job (or a group of jobs when --group_reporting
+// is used) on a single semicolon separated line. Fields are positional, see
+// the "Terse output" section of the fio documentation for the full layout.
+package terseparser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Signature is the prefix of every fio terse version 5 line
+const Signature = "5;fio-"
+
+// ErrSignature is returned for lines without the fio terse v5 signature
+var ErrSignature = errors.New("line does not have the fio terse v5 signature")
+
+// field positions of the fixed sections of a terse v5 line
+const (
+	readOffset    = 5
+	writeOffset   = 52
+	trimOffset    = 99
+	cpuOffset     = 146
+	ioDepthOffset = 151
+	latUsOffset   = 158
+	latMsOffset   = 168
+	diskOffset    = 180
+
+	percentileOffset = 12
+	percentileCount  = 20
+
+	diskFieldCount = 9
+)
+
+// Latency holds latency statistics (usec)
+type Latency struct {
+	Min    float64
+	Max    float64
+	Mean   float64
+	Stddev float64
+}
+
+// Percentile is a single latency percentile (usec)
+type Percentile struct {
+	Percentile float64
+	Value      float64
+}
+
+// Bin is a single bin of a latency histogram
+type Bin struct {
+	Value float64 // usec
+	Count uint64
+}
+
+// BandwidthStats holds bandwidth sample statistics (KiB/s)
+type BandwidthStats struct {
+	Min        float64
+	Max        float64
+	AggPercent float64
+	Mean       float64
+	Stddev     float64
+	Samples    float64
+}
+
+// IOPSStats holds IOPS sample statistics
+type IOPSStats struct {
+	Min     float64
+	Max     float64
+	Mean    float64
+	Stddev  float64
+	Samples float64
+}
+
+// IOStats holds the stats for one data direction (read, write or trim)
+type IOStats struct {
+	TotalIO   float64 // KiB
+	Bandwidth float64 // KiB/s
+	IOPS      float64
+	Runtime   float64 // msec
+	Slat      Latency
+	Clat      Latency
+	// Percentiles are total latency percentiles when fio is run with
+	// --lat_percentiles=1 and completion latency percentiles otherwise
+	Percentiles []Percentile
+	// ClatPercentiles are completion latency percentiles reported
+	// alongside total latency percentiles, only fio JSON output includes
+	// both
+	ClatPercentiles []Percentile
+	Lat             Latency
+	BandwidthStats  BandwidthStats
+	IOPSStats       IOPSStats
+	// Bins is the full latency histogram of the same latency as
+	// Percentiles, only fio json+ output includes it
+	Bins []Bin
+}
+
+// CPU holds CPU utilization and scheduler stats
+type CPU struct {
+	User            float64 // %
+	System          float64 // %
+	ContextSwitches float64
+	MajorFaults     float64
+	MinorFaults     float64
+}
+
+// Bucket is a single bucket of a percentage distribution
+type Bucket struct {
+	Label   string
+	Percent float64
+}
+
+// DiskUtil holds the utilization stats of one disk
+type DiskUtil struct {
+	Name        string
+	ReadIOs     float64
+	WriteIOs    float64
+	ReadMerges  float64
+	WriteMerges float64
+	ReadTicks   float64
+	WriteTicks  float64
+	InQueue     float64
+	Util        float64 // %
+}
+
+// Result holds all stats of a single terse v5 line
+type Result struct {
+	FioVersion string
+	JobName    string
+	GroupID    int
+	Error      int
+	Read       IOStats
+	Write      IOStats
+	Trim       IOStats
+	CPU        CPU
+	IODepth    []Bucket
+	// IODepthSubmit and IODepthComplete are only included in fio JSON
+	// output
+	IODepthSubmit   []Bucket
+	IODepthComplete []Bucket
+	LatencyUs       []Bucket
+	LatencyMs       []Bucket
+	Disks           []DiskUtil
+	// TotalErrors and FirstError are only reported by terse output when fio
+	// is run with --continue_on_error
+	TotalErrors int64
+	FirstError  int
+	Description string
+}
+
+// FieldError describes a field that could not be parsed
+type FieldError struct {
+	Field string
+	Index int
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("parsing %s (parts[%d]): %s", e.Field, e.Index, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+type ioField struct {
+	offset int
+	name   string
+	value  func(*IOStats) *float64
+}
+
+// ioFields maps offsets within a read, write or trim section to IOStats
+// fields. The completion latency percentiles are parsed separately.
+var ioFields = []ioField{
+	{0, "total_io", func(s *IOStats) *float64 { return &s.TotalIO }},
+	{1, "bw", func(s *IOStats) *float64 { return &s.Bandwidth }},
+	{2, "iops", func(s *IOStats) *float64 { return &s.IOPS }},
+	{3, "runtime", func(s *IOStats) *float64 { return &s.Runtime }},
+	{4, "slat_min", func(s *IOStats) *float64 { return &s.Slat.Min }},
+	{5, "slat_max", func(s *IOStats) *float64 { return &s.Slat.Max }},
+	{6, "slat_mean", func(s *IOStats) *float64 { return &s.Slat.Mean }},
+	{7, "slat_stddev", func(s *IOStats) *float64 { return &s.Slat.Stddev }},
+	{8, "clat_min", func(s *IOStats) *float64 { return &s.Clat.Min }},
+	{9, "clat_max", func(s *IOStats) *float64 { return &s.Clat.Max }},
+	{10, "clat_mean", func(s *IOStats) *float64 { return &s.Clat.Mean }},
+	{11, "clat_stddev", func(s *IOStats) *float64 { return &s.Clat.Stddev }},
+	{32, "lat_min", func(s *IOStats) *float64 { return &s.Lat.Min }},
+	{33, "lat_max", func(s *IOStats) *float64 { return &s.Lat.Max }},
+	{34, "lat_mean", func(s *IOStats) *float64 { return &s.Lat.Mean }},
+	{35, "lat_stddev", func(s *IOStats) *float64 { return &s.Lat.Stddev }},
+	{36, "bw_min", func(s *IOStats) *float64 { return &s.BandwidthStats.Min }},
+	{37, "bw_max", func(s *IOStats) *float64 { return &s.BandwidthStats.Max }},
+	{38, "bw_agg_pct", func(s *IOStats) *float64 { return &s.BandwidthStats.AggPercent }},
+	{39, "bw_mean", func(s *IOStats) *float64 { return &s.BandwidthStats.Mean }},
+	{40, "bw_stddev", func(s *IOStats) *float64 { return &s.BandwidthStats.Stddev }},
+	{41, "bw_samples", func(s *IOStats) *float64 { return &s.BandwidthStats.Samples }},
+	{42, "iops_min", func(s *IOStats) *float64 { return &s.IOPSStats.Min }},
+	{43, "iops_max", func(s *IOStats) *float64 { return &s.IOPSStats.Max }},
+	{44, "iops_mean", func(s *IOStats) *float64 { return &s.IOPSStats.Mean }},
+	{45, "iops_stddev", func(s *IOStats) *float64 { return &s.IOPSStats.Stddev }},
+	{46, "iops_samples", func(s *IOStats) *float64 { return &s.IOPSStats.Samples }},
+}
+
+type cpuField struct {
+	offset int
+	name   string
+	value  func(*CPU) *float64
+}
+
+var cpuFields = []cpuField{
+	{0, "cpu_user", func(c *CPU) *float64 { return &c.User }},
+	{1, "cpu_sys", func(c *CPU) *float64 { return &c.System }},
+	{2, "cpu_ctx", func(c *CPU) *float64 { return &c.ContextSwitches }},
+	{3, "cpu_majf", func(c *CPU) *float64 { return &c.MajorFaults }},
+	{4, "cpu_minf", func(c *CPU) *float64 { return &c.MinorFaults }},
+}
+
+// IODepthLabels are the fixed IO depth buckets reported by fio
+var IODepthLabels = []string{"1", "2", "4", "8", "16", "32", ">=64"}
+
+// IODepthSubmitLabels are the fixed IO submit and complete depth buckets
+// reported by fio
+var IODepthSubmitLabels = []string{"0", "4", "8", "16", "32", "64", ">=64"}
+
+// LatencyUsLabels are the upper bounds of the latency distribution buckets
+// in microseconds, the first bucket includes all sub-microsecond latencies
+var LatencyUsLabels = []string{"2", "4", "10", "20", "50", "100", "250", "500", "750", "1000"}
+
+// LatencyMsLabels are the upper bounds of the latency distribution buckets
+// in milliseconds
+var LatencyMsLabels = []string{"2", "4", "10", "20", "50", "100", "250", "500", "750", "1000", "2000", ">=2000"}
+
+// Percentile returns the latency for percentile p if fio reported it
+func (s *IOStats) Percentile(p float64) (float64, bool) {
+	return findPercentile(s.Percentiles, p)
+}
+
+// ClatPercentile returns the completion latency for percentile p if fio
+// reported it
+func (s *IOStats) ClatPercentile(p float64) (float64, bool) {
+	return findPercentile(s.ClatPercentiles, p)
+}
+
+func findPercentile(percentiles []Percentile, p float64) (float64, bool) {
+	for _, v := range percentiles {
+		if v.Percentile == p {
+			return v.Value, true
+		}
+	}
+	return 0, false
+}
+
+// Parse parses a single fio terse v5 line
+func Parse(line string) (*Result, error) {
+	if !strings.HasPrefix(line, Signature) {
+		return nil, ErrSignature
+	}
+	parts := strings.Split(strings.TrimRight(line, "\r\n"), ";")
+	if len(parts) < diskOffset {
+		return nil, fmt.Errorf("expected at least %d fields, got %d", diskOffset, len(parts))
+	}
+
+	r := &Result{
+		FioVersion: strings.TrimPrefix(parts[1], "fio-"),
+		JobName:    parts[2],
+	}
+	var err error
+	if r.GroupID, err = parseInt(parts, 3, "groupid"); err != nil {
+		return nil, err
+	}
+	if r.Error, err = parseInt(parts, 4, "error"); err != nil {
+		return nil, err
+	}
+
+	sections := []struct {
+		name   string
+		offset int
+		stats  *IOStats
+	}{
+		{"read", readOffset, &r.Read},
+		{"write", writeOffset, &r.Write},
+		{"trim", trimOffset, &r.Trim},
+	}
+	for _, s := range sections {
+		if err := parseIOStats(parts, s.offset, s.name, s.stats); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range cpuFields {
+		v, err := parseFloat(parts, cpuOffset+f.offset, f.name)
+		if err != nil {
+			return nil, err
+		}
+		*f.value(&r.CPU) = v
+	}
+
+	if r.IODepth, err = parseBuckets(parts, ioDepthOffset, "iodepth", IODepthLabels); err != nil {
+		return nil, err
+	}
+	if r.LatencyUs, err = parseBuckets(parts, latUsOffset, "lat_us", LatencyUsLabels); err != nil {
+		return nil, err
+	}
+	if r.LatencyMs, err = parseBuckets(parts, latMsOffset, "lat_ms", LatencyMsLabels); err != nil {
+		return nil, err
+	}
+
+	if err := parseTrailer(r, parts[diskOffset:]); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func parseIOStats(parts []string, offset int, name string, s *IOStats) error {
+	for _, f := range ioFields {
+		v, err := parseFloat(parts, offset+f.offset, name+"_"+f.name)
+		if err != nil {
+			return err
+		}
+		*f.value(s) = v
+	}
+	for i := 0; i < percentileCount; i++ {
+		index := offset + percentileOffset + i
+		p, err := parsePercentile(parts[index])
+		if err != nil {
+			return &FieldError{Field: name + "_percentile", Index: index, Err: err}
+		}
+		// fio pads the percentile list to 20 entries with "0%=0"
+		if p.Percentile == 0 {
+			continue
+		}
+		s.Percentiles = append(s.Percentiles, p)
+	}
+	return nil
+}
+
+// parsePercentile parses a percentile field such as "99.000000%=152"
+func parsePercentile(s string) (Percentile, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 {
+		return Percentile{}, fmt.Errorf("invalid percentile %q", s)
+	}
+	p, err := strconv.ParseFloat(strings.TrimSuffix(kv[0], "%"), 64)
+	if err != nil {
+		return Percentile{}, err
+	}
+	v, err := strconv.ParseFloat(kv[1], 64)
+	if err != nil {
+		return Percentile{}, err
+	}
+	return Percentile{Percentile: p, Value: v}, nil
+}
+
+func parseBuckets(parts []string, offset int, name string, labels []string) ([]Bucket, error) {
+	buckets := make([]Bucket, 0, len(labels))
+	for i, l := range labels {
+		v, err := parseFloat(parts, offset+i, name+"_"+l)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, Bucket{Label: l, Percent: v})
+	}
+	return buckets, nil
+}
+
+// parseTrailer parses the optional fields following the latency
+// distribution: one group of nine fields per disk involved in the
+// benchmark, the total error count and first error code when fio is run
+// with --continue_on_error and the job description if one is set. The disk
+// groups may follow the description, fields that are neither make up the
+// description.
+func parseTrailer(r *Result, parts []string) error {
+	var description []string
+	errorCounts := false
+	for len(parts) > 0 {
+		if len(parts) >= diskFieldCount && strings.HasSuffix(parts[diskFieldCount-1], "%") {
+			d, err := parseDisk(parts[:diskFieldCount])
+			if err != nil {
+				return err
+			}
+			r.Disks = append(r.Disks, d)
+			parts = parts[diskFieldCount:]
+			continue
+		}
+		if len(parts) >= 2 && !errorCounts && len(description) == 0 {
+			total, totalErr := strconv.ParseInt(parts[0], 10, 64)
+			first, firstErr := strconv.Atoi(parts[1])
+			if totalErr == nil && firstErr == nil {
+				r.TotalErrors, r.FirstError = total, first
+				errorCounts = true
+				parts = parts[2:]
+				continue
+			}
+		}
+		description = append(description, parts[0])
+		parts = parts[1:]
+	}
+	r.Description = strings.Join(description, ";")
+	return nil
+}
+
+func parseDisk(group []string) (DiskUtil, error) {
+	d := DiskUtil{Name: group[0]}
+	values := []*float64{
+		&d.ReadIOs, &d.WriteIOs,
+		&d.ReadMerges, &d.WriteMerges,
+		&d.ReadTicks, &d.WriteTicks,
+		&d.InQueue, &d.Util,
+	}
+	for i, v := range values {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(group[i+1], "%"), 64)
+		if err != nil {
+			return DiskUtil{}, fmt.Errorf("parsing disk %s: %w", d.Name, err)
+		}
+		*v = f
+	}
+	return d, nil
+}
+
+func parseFloat(parts []string, index int, name string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(parts[index], "%"), 64)
+	if err != nil {
+		return 0, &FieldError{Field: name, Index: index, Err: err}
+	}
+	return v, nil
+}
+
+func parseInt(parts []string, index int, name string) (int, error) {
+	v, err := strconv.Atoi(parts[index])
+	if err != nil {
+		return 0, &FieldError{Field: name, Index: index, Err: err}
+	}
+	return v, nil
+}
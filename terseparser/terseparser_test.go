@@ -0,0 +1,155 @@
+package terseparser
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestParseGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.terse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no testdata found")
+	}
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".terse")
+		t.Run(name, func(t *testing.T) {
+			line, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := Parse(strings.TrimSpace(string(line)))
+			if err != nil {
+				t.Fatalf("Parse: %s", err)
+			}
+			got, err := json.MarshalIndent(result, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("result does not match %s, run with -update to regenerate\ngot:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	line, err := os.ReadFile(filepath.Join("testdata", "latency.terse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Parse(string(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// positions of fields in the terse v5 layout
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"read bw (parts[6])", r.Read.Bandwidth, 47144},
+		{"read iops (parts[7])", r.Read.IOPS, 11786},
+		{"read slat min (parts[9])", r.Read.Slat.Min, 2},
+		{"read clat mean (parts[15])", r.Read.Clat.Mean, 62.9},
+		{"read clat stddev (parts[16])", r.Read.Clat.Stddev, 21.4},
+		{"read lat p90 (parts[27])", r.Read.Percentiles[10].Value, 88},
+		{"read lat p99 (parts[29])", r.Read.Percentiles[12].Value, 152},
+		{"read lat min (parts[37])", r.Read.Lat.Min, 48},
+		{"read bw mean (parts[44])", r.Read.BandwidthStats.Mean, 47090.12605},
+		{"read iops mean (parts[49])", r.Read.IOPSStats.Mean, 11772.495798},
+		{"write bw (parts[53])", r.Write.Bandwidth, 47066},
+		{"write lat p95 (parts[75])", r.Write.Percentiles[11].Value, 21},
+		{"write lat mean (parts[86])", r.Write.Lat.Mean, 17.200195},
+		{"write iops max (parts[95])", r.Write.IOPSStats.Max, 13371},
+		{"cpu user (parts[146])", r.CPU.User, 2.686667},
+		{"cpu sys (parts[147])", r.CPU.System, 9.488333},
+		{"cpu ctx (parts[148])", r.CPU.ContextSwitches, 1412318},
+		{"cpu minf (parts[150])", r.CPU.MinorFaults, 37},
+		{"iodepth 1 (parts[151])", r.IODepth[0].Percent, 100},
+		{"lat 50us (parts[162])", r.LatencyUs[4].Percent, 27.43},
+		{"lat 2ms (parts[168])", r.LatencyMs[0].Percent, 0.07},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	line, err := os.ReadFile(filepath.Join("testdata", "latency.terse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(strings.TrimSpace(string(line)), ";")
+
+	if _, err := Parse("fio: terminating on signal 15"); !errors.Is(err, ErrSignature) {
+		t.Errorf("missing signature: got %v, want ErrSignature", err)
+	}
+	if _, err := Parse(""); !errors.Is(err, ErrSignature) {
+		t.Errorf("empty line: got %v, want ErrSignature", err)
+	}
+	if _, err := Parse(strings.Join(parts[:100], ";")); err == nil {
+		t.Error("truncated line: expected error")
+	}
+
+	bad := append([]string(nil), parts...)
+	bad[53] = "n/a"
+	_, err = Parse(strings.Join(bad, ";"))
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("bad field: got %v, want *FieldError", err)
+	}
+	if fe.Index != 53 || fe.Field != "write_bw" {
+		t.Errorf("bad field: got %s (%d), want write_bw (53)", fe.Field, fe.Index)
+	}
+}
+
+func TestParseTrailer(t *testing.T) {
+	disk := []string{"sda", "100", "200", "0", "3", "1000", "2000", "3000", "99.84%"}
+	tests := []struct {
+		name        string
+		parts       []string
+		disks       int
+		errors      int64
+		description string
+	}{
+		{"disks", disk, 1, 0, ""},
+		{"disks, errors, description", append(append([]string(nil), disk...), "12", "5", "nightly run"), 1, 12, "nightly run"},
+		{"errors, description, disks", append([]string{"12", "5", "nightly run"}, disk...), 1, 12, "nightly run"},
+		{"description with separators", append([]string{"0", "0", "run", "42"}, disk...), 1, 0, "run;42"},
+	}
+	for _, tt := range tests {
+		var r Result
+		if err := parseTrailer(&r, tt.parts); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if len(r.Disks) != tt.disks || r.TotalErrors != tt.errors || r.Description != tt.description {
+			t.Errorf("%s: got %d disks, %d errors, description %q", tt.name, len(r.Disks), r.TotalErrors, r.Description)
+		}
+	}
+}